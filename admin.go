@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const PERMISSION_ANYONE = 0
+const PERMISSION_CHAT_ADMIN = 1
+const PERMISSION_BOT_ADMIN = 2
+
+// how long the list of chat administrators fetched from telegram is trusted
+const CHAT_ADMINS_CACHE_TIMEOUT = 10 * time.Minute
+
+// commands missing from this map are available to everyone
+var commandPermissions = map[string]int{
+	"announce": PERMISSION_CHAT_ADMIN,
+	"reports":  PERMISSION_BOT_ADMIN,
+	"resolve":  PERMISSION_BOT_ADMIN,
+	"reload":   PERMISSION_BOT_ADMIN,
+	"import":   PERMISSION_BOT_ADMIN,
+	"stats":    PERMISSION_BOT_ADMIN,
+	"ban":      PERMISSION_BOT_ADMIN,
+	"unban":    PERMISSION_BOT_ADMIN,
+}
+
+// same for the command namespace of inline button callbacks
+var callbackPermissions = map[string]int{
+	"fix": PERMISSION_BOT_ADMIN,
+}
+
+var botAdmins = loadBotAdmins()
+
+type BannedUser struct {
+	UserId   int `sql:",pk"`
+	BannedBy int
+	Reason   string
+	Created  time.Time
+}
+
+type BanList struct {
+	mx    sync.RWMutex
+	value map[int]bool
+}
+
+type chatAdminList struct {
+	users  map[int]bool
+	loaded time.Time
+}
+
+type ChatAdmins struct {
+	mx    sync.Mutex
+	value map[int64]*chatAdminList
+}
+
+var bannedUsers = BanList{value: make(map[int]bool)}
+var chatAdmins = ChatAdmins{value: make(map[int64]*chatAdminList)}
+
+// loadBotAdmins reads comma separated telegram user ids from [admin] users
+func loadBotAdmins() map[int]bool {
+	admins := make(map[int]bool)
+	for _, id := range config.Section("admin").Key("users").Ints(",") {
+		admins[id] = true
+	}
+	return admins
+}
+
+func loadBans() error {
+	var bans []BannedUser
+	err := session.Model(&bans).Select()
+	if err != nil {
+		return err
+	}
+	bannedUsers.mx.Lock()
+	defer bannedUsers.mx.Unlock()
+	for _, ban := range bans {
+		bannedUsers.value[ban.UserId] = true
+	}
+	return nil
+}
+
+func isBanned(userId int) bool {
+	bannedUsers.mx.RLock()
+	defer bannedUsers.mx.RUnlock()
+	return bannedUsers.value[userId]
+}
+
+// isChatAdmin asks telegram for administrators of the chat, answers are cached
+// The lock isn't held while telegram answers, so other chats don't wait for it.
+func isChatAdmin(api Sender, chatId int64, userId int) bool {
+	chatAdmins.mx.Lock()
+	list, ok := chatAdmins.value[chatId]
+	chatAdmins.mx.Unlock()
+	if !ok || time.Since(list.loaded) > CHAT_ADMINS_CACHE_TIMEOUT {
+		members, err := api.GetChatAdministrators(tgbotapi.ChatConfig{ChatID: chatId})
+		if err != nil {
+			log.Printf("[Error] Can`t get administrators of chat %v: %v", chatId, err)
+			return false
+		}
+		list = &chatAdminList{users: make(map[int]bool), loaded: time.Now()}
+		for _, member := range members {
+			list.users[member.User.ID] = true
+		}
+		chatAdmins.mx.Lock()
+		chatAdmins.value[chatId] = list
+		chatAdmins.mx.Unlock()
+	}
+	return list.users[userId]
+}
+
+// isBotAdmin reports whether the user is listed in [admin] users
+// or administers the chat configured in [admin] chat_id
+func isBotAdmin(api Sender, userId int) bool {
+	if botAdmins[userId] {
+		return true
+	}
+	return adminChatId != 0 && isChatAdmin(api, adminChatId, userId)
+}
+
+func (command *Command) chatId() int64 {
+	if command.tgRequest.CallbackQuery != nil {
+		return command.tgRequest.CallbackQuery.Message.Chat.ID
+	}
+	return command.tgRequest.Message.Chat.ID
+}
+
+func (command *Command) fromUser() *tgbotapi.User {
+	if command.tgRequest.CallbackQuery != nil {
+		return command.tgRequest.CallbackQuery.From
+	}
+	return command.tgRequest.Message.From
+}
+
+func (command *Command) isPrivateChat() bool {
+	if command.tgRequest.CallbackQuery != nil {
+		return command.tgRequest.CallbackQuery.Message.Chat.IsPrivate()
+	}
+	return command.tgRequest.Message.Chat.IsPrivate()
+}
+
+// hasPermission checks the author of the message or callback against the required level.
+// Bot admins may do everything, in private chats the user is the admin of the chat.
+func (command *Command) hasPermission(api Sender, level int) bool {
+	userId := command.fromUser().ID
+	switch {
+	case level == PERMISSION_ANYONE:
+		return true
+	case isBotAdmin(api, userId):
+		return true
+	case level == PERMISSION_CHAT_ADMIN:
+		return command.isPrivateChat() || isChatAdmin(api, command.chatId(), userId)
+	}
+	return false
+}
+
+func (command *Command) ReloadTemplates(api Sender) error {
+	err := loadTemplates()
+	if err != nil {
+		send(api, command.NewMessage(command.tr("templates_reload_failed", html.EscapeString(err.Error()))))
+		return err
+	}
+	return send(api, command.NewMessage(command.tr("templates_reloaded")))
+}
+
+func (command *Command) ImportCatalog(api Sender) error {
+	if err := send(api, command.NewMessage(command.tr("import_started"))); err != nil {
+		return err
+	}
+	cards, skills, err := importCatalog(
+		config.Section("import").Key("cards").MustString("parsed.csv"),
+		config.Section("import").Key("skills").MustString("parsed_skills.csv"),
+	)
+	if err != nil {
+		send(api, command.NewMessage(command.tr("import_failed", html.EscapeString(err.Error()))))
+		return err
+	}
+	if err := send(api, command.NewMessage(command.tr("import_finished", cards, skills))); err != nil {
+		return err
+	}
+	stages, enemies, serr := importStagesIfExists(config.Section("import").Key("stages").MustString("parsed_stages.csv"))
+	if serr != nil {
+		send(api, command.NewMessage(command.tr("import_failed", html.EscapeString(serr.Error()))))
+		return serr
+	}
+	if stages > 0 {
+		if err := send(api, command.NewMessage(command.tr("import_stages_finished", stages, enemies))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (command *Command) Stats(api Sender) error {
+	var b strings.Builder
+	stats := []struct {
+		title string
+		model interface{}
+		where string
+	}{
+		{"stats_cards", (*Card)(nil), ""},
+		{"stats_skills", (*Skill)(nil), ""},
+		{"stats_polls", (*Poll)(nil), ""},
+		{"stats_active_polls", (*Poll)(nil), "closed = false"},
+		{"stats_votes", (*PollUser)(nil), ""},
+		{"stats_reminders", (*Reminder)(nil), ""},
+		{"stats_open_reports", (*Report)(nil), fmt.Sprintf("status = %v", REPORT_STATUS_OPEN)},
+		{"stats_banned", (*BannedUser)(nil), ""},
+	}
+	b.WriteString(command.tr("stats_title") + "\n")
+	for _, stat := range stats {
+		query := session.Model(stat.model)
+		if stat.where != "" {
+			query = query.Where(stat.where)
+		}
+		count, err := query.Count()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%v: %v\n", command.tr(stat.title), count)
+	}
+	return send(api, command.NewMessage(b.String()))
+}
+
+// banTarget takes the user id either from the first parameter
+// or from the author of the message the command replies to
+func (command *Command) banTarget(params string) (int, string, bool) {
+	words := strings.Fields(params)
+	if reply := command.tgRequest.Message.ReplyToMessage; reply != nil && reply.From != nil {
+		return reply.From.ID, strings.Join(words, " "), true
+	}
+	if len(words) == 0 {
+		return 0, "", false
+	}
+	userId, err := strconv.Atoi(words[0])
+	if err != nil {
+		return 0, "", false
+	}
+	return userId, strings.Join(words[1:], " "), true
+}
+
+func (command *Command) Ban(api Sender, params string) error {
+	userId, reason, ok := command.banTarget(params)
+	if !ok {
+		return send(api, command.NewMessage(command.tr("ban_usage")))
+	}
+	if isBotAdmin(api, userId) {
+		return send(api, command.NewMessage(command.tr("ban_admin")))
+	}
+	ban := BannedUser{
+		UserId:   userId,
+		BannedBy: command.fromUser().ID,
+		Reason:   reason,
+		Created:  time.Now(),
+	}
+	_, err := session.Model(&ban).OnConflict("(user_id) DO NOTHING").Insert()
+	if err != nil {
+		return err
+	}
+	bannedUsers.mx.Lock()
+	bannedUsers.value[userId] = true
+	bannedUsers.mx.Unlock()
+	return send(api, command.NewMessage(command.tr("banned", userId)))
+}
+
+func (command *Command) Unban(api Sender, params string) error {
+	userId, _, ok := command.banTarget(params)
+	if !ok {
+		return send(api, command.NewMessage(command.tr("unban_usage")))
+	}
+	_, err := session.Model(&BannedUser{}).Where("user_id = ?", userId).Delete()
+	if err != nil {
+		return err
+	}
+	bannedUsers.mx.Lock()
+	delete(bannedUsers.value, userId)
+	bannedUsers.mx.Unlock()
+	return send(api, command.NewMessage(command.tr("unbanned", userId)))
+}
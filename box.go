@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// OwnedCard is a card in the personal box of a telegram user
+type OwnedCard struct {
+	UserId  int    `sql:",pk"`
+	CardId  string `sql:",pk"`
+	Created time.Time
+}
+
+// ownedLabel marks names of owned cards on buttons
+func ownedLabel(name string, owned bool) string {
+	if owned {
+		return "✅ " + name
+	}
+	return name
+}
+
+// existingCardIds splits ids into known cards and unknown ids
+func existingCardIds(ids []string) ([]string, []string, error) {
+	known, err := cardStore.ExistingCardIds(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	exists := make(map[string]bool)
+	for _, id := range known {
+		exists[id] = true
+	}
+	var unknown []string
+	for _, id := range ids {
+		if !exists[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	return known, unknown, nil
+}
+
+// Own handles /own add [ids] and /own remove [ids]
+func (command *Command) Own(api Sender, params string) error {
+	words := strings.Fields(params)
+	if len(words) < 2 || (words[0] != "add" && words[0] != "remove") {
+		return send(api, command.NewMessage(command.tr("own_usage")))
+	}
+	userId := command.fromUser().ID
+	ids := words[1:]
+	if words[0] == "remove" {
+		removed, err := chatStore.RemoveOwnedCards(userId, ids)
+		if err != nil {
+			return err
+		}
+		return send(api, command.NewMessage(command.tr("own_removed", removed)))
+	}
+
+	known, unknown, err := existingCardIds(ids)
+	if err != nil {
+		return err
+	}
+	added, err := chatStore.AddOwnedCards(userId, known)
+	if err != nil {
+		return err
+	}
+	text := command.tr("own_added", added)
+	if len(unknown) > 0 {
+		text += "\n" + command.tr("own_unknown", html.EscapeString(strings.Join(unknown, " ")))
+	}
+	return send(api, command.NewMessage(text))
+}
+
+// Box lists cards owned by the user
+func (command *Command) Box(api Sender) error {
+	cards, err := cardStore.OwnedCards(command.fromUser().ID)
+	if err != nil {
+		return err
+	}
+	if len(cards) == 0 {
+		return send(api, command.NewMessage(command.tr("box_empty")))
+	}
+	var b strings.Builder
+	b.WriteString(command.tr("box_title", len(cards)) + "\n")
+	for i, card := range cards {
+		line := fmt.Sprintf("• [id:%v] <b>%v</b> %v* (%v)\n", card.Card_id, html.EscapeString(card.Name), card.Rarity, html.EscapeString(card.Attribute))
+		// a big box is cut where the rest would not fit into the message
+		more := command.tr("box_more", len(cards)-i) + "\n"
+		if b.Len()+len(line)+len(more) > TELEGRAM_MESSAGE_LIMIT {
+			b.WriteString(more)
+			break
+		}
+		b.WriteString(line)
+	}
+	return send(api, command.NewMessage(b.String()))
+}
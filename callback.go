@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// callback data is "<version>|<namespace>|<field>...|<signature>".
+// The version allows to change the format while old buttons are still around.
+const CALLBACK_VERSION = "1"
+const CALLBACK_SEPARATOR = "|"
+
+// telegram rejects buttons with longer callback data
+const CALLBACK_MAX_LENGTH = 64
+
+// bytes of the HMAC kept in the callback data, 11 characters in base64
+const CALLBACK_SIGNATURE_SIZE = 8
+
+var callbackSecret = loadCallbackSecret()
+
+var callbackEscaper = strings.NewReplacer("%", "%25", CALLBACK_SEPARATOR, "%7C")
+var callbackUnescaper = strings.NewReplacer("%7C", CALLBACK_SEPARATOR, "%25", "%")
+
+// loadCallbackSecret reads [telegram] callback_secret,
+// without it the key is derived from the bot token, which is secret as well
+func loadCallbackSecret() []byte {
+	secret := config.Section("telegram").Key("callback_secret").Value()
+	if secret == "" {
+		secret = "callback:" + config.Section("telegram").Key("token").Value()
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+func signCallback(payload string) string {
+	mac := hmac.New(sha256.New, callbackSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:CALLBACK_SIGNATURE_SIZE])
+}
+
+// encodeCallback builds signed callback data of the command namespace, fields may contain any characters
+func encodeCallback(namespace string, fields ...string) (string, error) {
+	parts := make([]string, 0, len(fields)+2)
+	parts = append(parts, CALLBACK_VERSION, callbackEscaper.Replace(namespace))
+	for _, field := range fields {
+		parts = append(parts, callbackEscaper.Replace(field))
+	}
+	payload := strings.Join(parts, CALLBACK_SEPARATOR)
+	data := payload + CALLBACK_SEPARATOR + signCallback(payload)
+	if len(data) > CALLBACK_MAX_LENGTH {
+		return "", fmt.Errorf("Callback data %q is %v bytes long, the limit is %v", payload, len(data), CALLBACK_MAX_LENGTH)
+	}
+	return data, nil
+}
+
+// decodeCallback checks the version and the signature and returns the namespace followed by the fields
+func decodeCallback(data string) ([]string, error) {
+	if len(data) > CALLBACK_MAX_LENGTH {
+		return nil, errors.New("Callback data is too long")
+	}
+	i := strings.LastIndex(data, CALLBACK_SEPARATOR)
+	if i < 0 {
+		return nil, errors.New("Callback data is not signed")
+	}
+	payload, signature := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(signCallback(payload))) {
+		return nil, fmt.Errorf("Wrong signature of callback data %q", payload)
+	}
+	parts := strings.Split(payload, CALLBACK_SEPARATOR)
+	if parts[0] != CALLBACK_VERSION {
+		return nil, fmt.Errorf("Unsupported version of callback data %q", payload)
+	}
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("Wrong callback data %q", payload)
+	}
+	result := make([]string, len(parts)-1)
+	for j, part := range parts[1:] {
+		result[j] = callbackUnescaper.Replace(part)
+	}
+	return result, nil
+}
+
+// features keeping their state in redis
+const CALLBACK_STATE_FIND = "find"
+const CALLBACK_STATE_CONVERSATION = "conversation"
+
+// the state of buttons is forgotten after [redis] state_ttl, buttons of older messages answer that they expired
+var callbackStateTimeout = config.Section("redis").Key("state_ttl").MustDuration(24 * time.Hour)
+
+// callbackStateKey is unique per feature and message or user, message ids are counted per chat
+func callbackStateKey(feature string, chatId int64, id int) string {
+	return fmt.Sprintf("state:%v:%v:%v", feature, chatId, id)
+}
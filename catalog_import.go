@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/go-pg/pg"
+)
+
+// readCatalogCsv reads a file written by parser.go
+func readCatalogCsv(path string) ([][]string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	r := csv.NewReader(in)
+	r.Comma = '$'
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	return r.ReadAll()
+}
+
+// importCatalog loads cards and skills produced by the crawler into the database.
+// Skills are matched by name and type because the crawler generates new uuids on
+// every run, cards are matched by their in-game id. Approved corrections are
+// applied on top, so manual fixes survive the import.
+func importCatalog(cardsPath string, skillsPath string) (int, int, error) {
+	skillRows, err := readCatalogCsv(skillsPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	cardRows, err := readCatalogCsv(cardsPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	cardsCount, skillsCount := 0, 0
+	err = session.RunInTransaction(func(tx *pg.Tx) error {
+		var skills []Skill
+		var cards []Card
+		err := tx.Model(&skills).Column("id", "name", "type").Select()
+		if err != nil {
+			return err
+		}
+		skillIds := make(map[string]int)
+		for _, skill := range skills {
+			skillIds[fmt.Sprintf("%v|%v", skill.Type, skill.Name)] = skill.Id
+		}
+		uuids := make(map[string]int)
+		for _, row := range skillRows {
+			if len(row) < 6 {
+				continue
+			}
+			skill := Skill{SkillId: row[0], Name: row[1], Effect: row[4]}
+			skill.Lv1cd, _ = strconv.Atoi(row[2])
+			skill.Lvmaxcd, _ = strconv.Atoi(row[3])
+			skill.Type, _ = strconv.Atoi(row[5])
+			key := fmt.Sprintf("%v|%v", skill.Type, skill.Name)
+			if id, exists := skillIds[key]; exists {
+				skill.Id = id
+				err = tx.Update(&skill)
+			} else {
+				err = tx.Insert(&skill)
+				skillIds[key] = skill.Id
+			}
+			if err != nil {
+				return err
+			}
+			uuids[skill.SkillId] = skill.Id
+			skillsCount++
+		}
+
+		err = tx.Model(&cards).Column("id", "card_id").Select()
+		if err != nil {
+			return err
+		}
+		cardIds := make(map[string]int)
+		for _, card := range cards {
+			cardIds[card.Card_id] = card.Id
+		}
+		for _, row := range cardRows {
+			if len(row) < 16 {
+				continue
+			}
+			// a missing skill has an empty uuid, the id stays 0 and is stored as NULL
+			card := Card{
+				Card_id:       row[0],
+				Name:          row[1],
+				Attribute:     row[2],
+				Race:          row[5],
+				Series:        row[6],
+				WikiLink:      row[12],
+				PreviewLink:   row[13],
+				ActiveSkillId: uuids[row[14]],
+				LeaderSkillId: uuids[row[15]],
+			}
+			card.Rarity, _ = strconv.Atoi(row[3])
+			card.Cost, _ = strconv.Atoi(row[4])
+			card.MaxExp, _ = strconv.Atoi(row[7])
+			card.Max_hp, _ = strconv.Atoi(row[8])
+			card.Max_attk, _ = strconv.Atoi(row[9])
+			card.Max_rec, _ = strconv.Atoi(row[10])
+			card.TotalStats, _ = strconv.Atoi(row[11])
+			if id, exists := cardIds[card.Card_id]; exists {
+				card.Id = id
+				err = tx.Update(&card)
+			} else {
+				err = tx.Insert(&card)
+				cardIds[card.Card_id] = card.Id
+			}
+			if err != nil {
+				return err
+			}
+			cardsCount++
+		}
+		return applyCardOverrides(tx)
+	})
+	return cardsCount, skillsCount, err
+}
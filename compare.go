@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg"
+)
+
+const COMPARE_MIN_CARDS = 2
+const COMPARE_MAX_CARDS = 3
+
+// CompareCell is a value of one card in a row of the comparison,
+// Best marks the value which is better than the others
+type CompareCell struct {
+	Value string
+	Best  bool
+}
+
+// Comparison is the data of the compare template, cells follow the order of Cards
+type Comparison struct {
+	Cards       []*Card
+	Cost        []CompareCell
+	Rarity      []CompareCell
+	Hp          []CompareCell
+	Attack      []CompareCell
+	Recovery    []CompareCell
+	Total       []CompareCell
+	ActiveCd    []CompareCell
+	ActiveMaxCd []CompareCell
+}
+
+// compareRow builds cells of one row. value returns false when the card has no such value,
+// e.g. the cooldown of a missing skill. Nothing is highlighted if all values are equal.
+func compareRow(cards []*Card, lowerIsBetter bool, value func(card *Card) (int, bool)) []CompareCell {
+	cells := make([]CompareCell, len(cards))
+	values := make([]int, len(cards))
+	present := make([]bool, len(cards))
+	best, found, differ := 0, false, false
+	for i, card := range cards {
+		values[i], present[i] = value(card)
+		if !present[i] {
+			cells[i].Value = "—"
+			continue
+		}
+		cells[i].Value = strconv.Itoa(values[i])
+		switch {
+		case !found:
+			best, found = values[i], true
+		case values[i] != best:
+			differ = true
+			if (values[i] < best) == lowerIsBetter {
+				best = values[i]
+			}
+		}
+	}
+	for i := range cells {
+		cells[i].Best = differ && present[i] && values[i] == best
+	}
+	return cells
+}
+
+func newComparison(cards []*Card) *Comparison {
+	return &Comparison{
+		Cards:    cards,
+		Cost:     compareRow(cards, true, func(card *Card) (int, bool) { return card.Cost, true }),
+		Rarity:   compareRow(cards, false, func(card *Card) (int, bool) { return card.Rarity, true }),
+		Hp:       compareRow(cards, false, func(card *Card) (int, bool) { return card.Max_hp, true }),
+		Attack:   compareRow(cards, false, func(card *Card) (int, bool) { return card.Max_attk, true }),
+		Recovery: compareRow(cards, false, func(card *Card) (int, bool) { return card.Max_rec, true }),
+		Total:    compareRow(cards, false, func(card *Card) (int, bool) { return card.TotalStats, true }),
+		ActiveCd: compareRow(cards, true, func(card *Card) (int, bool) {
+			if card.ActiveSkill == nil {
+				return 0, false
+			}
+			return card.ActiveSkill.Lv1cd, true
+		}),
+		ActiveMaxCd: compareRow(cards, true, func(card *Card) (int, bool) {
+			if card.ActiveSkill == nil {
+				return 0, false
+			}
+			return card.ActiveSkill.Lvmaxcd, true
+		}),
+	}
+}
+
+func (command *Command) Compare(api Sender, params string) error {
+	ids := strings.Fields(params)
+	if len(ids) < COMPARE_MIN_CARDS || len(ids) > COMPARE_MAX_CARDS {
+		return send(api, command.NewMessage(command.tr("compare_usage")))
+	}
+	cards := make([]*Card, 0, len(ids))
+	for _, id := range ids {
+		card, err := command.GetCardById(id)
+		if err == pg.ErrNoRows {
+			return send(api, command.NewMessage(command.tr("compare_card_not_found", id)))
+		} else if err != nil {
+			return err
+		}
+		cards = append(cards, card)
+	}
+	res, err := renderTemplate(TEMPLATE_COMPARE, command.lang(), newComparison(cards))
+	if err != nil {
+		return err
+	}
+	msg := command.NewMessage(res)
+	msg.DisableWebPagePreview = true
+	return send(api, msg)
+}
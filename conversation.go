@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// an unanswered question is forgotten after this timeout
+const CONVERSATION_TIMEOUT = 10 * time.Minute
+
+// conversationStep asks a question, check validates the answer and returns it normalized.
+// A non empty problem is the message explaining what is wrong with the answer.
+type conversationStep struct {
+	prompt func(command *Command) string
+	check  func(command *Command, answer string) (value string, problem string, err error)
+}
+
+// conversationFlow is a multi-step command, finish gets the answers of all steps
+type conversationFlow struct {
+	steps  []conversationStep
+	finish func(command *Command, api Sender, params string, answers []string) error
+}
+
+// Conversation is the state of a flow started by a user in a chat, it is kept in stateStore
+// for CONVERSATION_TIMEOUT after the last answer. PromptId is the message with the current question.
+type Conversation struct {
+	Flow     string
+	Params   string
+	Answers  []string
+	PromptId int
+}
+
+// flows are filled in init, because their steps refer to command methods
+var conversationFlows map[string]*conversationFlow
+
+func init() {
+	conversationFlows = map[string]*conversationFlow{
+		"team": teamFlow,
+		"fix":  fixFlow,
+		"poll": pollFlow,
+	}
+}
+
+// conversation returns the active conversation of the user in the chat, nil when there is none or it has expired
+func (command *Command) conversation() (*Conversation, error) {
+	data, found, err := stateStore.LoadState(CALLBACK_STATE_CONVERSATION, command.chatId(), command.fromUser().ID)
+	if err != nil || !found {
+		return nil, err
+	}
+	var conversation Conversation
+	if err := json.Unmarshal([]byte(data), &conversation); err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// saveConversation keeps the conversation for another CONVERSATION_TIMEOUT
+func (command *Command) saveConversation(conversation *Conversation) error {
+	encoded, err := json.Marshal(conversation)
+	if err != nil {
+		return err
+	}
+	return stateStore.SaveState(CALLBACK_STATE_CONVERSATION, command.chatId(), command.fromUser().ID, string(encoded), CONVERSATION_TIMEOUT)
+}
+
+func (command *Command) endConversation() error {
+	return stateStore.DeleteState(CALLBACK_STATE_CONVERSATION, command.chatId(), command.fromUser().ID)
+}
+
+// startConversation replaces the current conversation of the user with a new one
+// and asks the first question. Params are passed to the finish function of the flow.
+func (command *Command) startConversation(api Sender, flow string, params string) error {
+	return command.askStep(api, &Conversation{Flow: flow, Params: params}, "")
+}
+
+// askStep sends the question of the current step, prefixed with the problem of the previous answer,
+// and saves the conversation waiting for the reply to it.
+// The question forces a reply, so the answer reaches the bot in groups with privacy mode too.
+func (command *Command) askStep(api Sender, conversation *Conversation, problem string) error {
+	step := conversationFlows[conversation.Flow].steps[len(conversation.Answers)]
+	text := step.prompt(command) + "\n\n" + command.tr("conversation_hint")
+	if problem != "" {
+		text = problem + "\n\n" + text
+	}
+	msg := command.NewMessage(text)
+	msg.ReplyToMessageID = command.tgRequest.Message.MessageID
+	msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true, Selective: true}
+	message, err := api.Send(msg)
+	if err != nil {
+		return err
+	}
+	conversation.PromptId = message.MessageID
+	return command.saveConversation(conversation)
+}
+
+// continueConversation takes a reply to the current question as the answer.
+// Returns false when there is no conversation, the message is not a reply to the question
+// or is another command, the latter ends the conversation. Banned users are left to Run.
+func (command *Command) continueConversation(api Sender) (bool, error) {
+	if isBanned(command.fromUser().ID) {
+		return false, nil
+	}
+	conversation, err := command.conversation()
+	if err != nil {
+		// the message may still be a command
+		log.Printf("[Error] Can`t load conversation of user %v: %v", command.fromUser().ID, err)
+		return false, nil
+	}
+	if conversation == nil {
+		return false, nil
+	}
+	text := strings.TrimSpace(command.raw_text)
+	word := ""
+	if command.IsValid() {
+		matches := re2.FindStringSubmatch(strings.Replace(text, "@tos_helper_bot", "", 1))
+		word = matches[1]
+	}
+	switch word {
+	case "":
+		reply := command.tgRequest.Message.ReplyToMessage
+		if reply == nil || reply.MessageID != conversation.PromptId {
+			return false, nil
+		}
+	case "cancel":
+		if err := command.endConversation(); err != nil {
+			return true, err
+		}
+		return true, send(api, command.NewMessage(command.tr("conversation_cancelled")))
+	case "back":
+		if len(conversation.Answers) > 0 {
+			conversation.Answers = conversation.Answers[:len(conversation.Answers)-1]
+		}
+		return true, command.askStep(api, conversation, "")
+	default:
+		if err := command.endConversation(); err != nil {
+			log.Printf("[Error] Can`t end conversation of user %v: %v", command.fromUser().ID, err)
+		}
+		return false, nil
+	}
+
+	flow := conversationFlows[conversation.Flow]
+	step := flow.steps[len(conversation.Answers)]
+	value, problem, err := step.check(command, text)
+	if err != nil {
+		return true, err
+	}
+	if problem != "" {
+		return true, command.askStep(api, conversation, problem)
+	}
+	conversation.Answers = append(conversation.Answers, value)
+	if len(conversation.Answers) < len(flow.steps) {
+		return true, command.askStep(api, conversation, "")
+	}
+	if err := command.endConversation(); err != nil {
+		return true, err
+	}
+	// the answer is not a command, buttons created by finish need the namespace of the flow
+	command.commWord = conversation.Flow
+	return true, flow.finish(command, api, conversation.Params, conversation.Answers)
+}
+
+// NoConversation answers /cancel and /back sent when nothing is asked
+func (command *Command) NoConversation(api Sender) error {
+	return send(api, command.NewMessage(command.tr("conversation_none")))
+}
+
+// ask returns a prompt showing the message with the given key
+func ask(key string) func(command *Command) string {
+	return func(command *Command) string {
+		return command.tr(key)
+	}
+}
+
+// checkAnything accepts any non empty answer
+func checkAnything(command *Command, answer string) (string, string, error) {
+	if answer == "" {
+		return "", command.tr("conversation_empty_answer"), nil
+	}
+	return answer, "", nil
+}
+
+// checkCardIds returns a check accepting the given number of existing card ids
+func checkCardIds(count int) func(command *Command, answer string) (string, string, error) {
+	return func(command *Command, answer string) (string, string, error) {
+		ids := strings.Fields(strings.Replace(answer, ",", " ", -1))
+		if len(ids) != count {
+			return "", command.tr("conversation_ids_count", count), nil
+		}
+		_, unknown, err := existingCardIds(ids)
+		if err != nil {
+			return "", "", err
+		}
+		if len(unknown) > 0 {
+			return "", command.tr("conversation_ids_not_found", html.EscapeString(strings.Join(unknown, " "))), nil
+		}
+		return strings.Join(ids, " "), "", nil
+	}
+}
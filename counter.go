@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const COUNTER_MAX_CARDS = 5
+const COUNTER_MAX_LEADERS = 3
+
+// CounterLeader is a card whose leader skill boosts the attack of the counter attribute
+type CounterLeader struct {
+	Card       *Card
+	Multiplier float64
+}
+
+// AttributeCounter lists cards of an attribute strong against some of the stage enemies,
+// Share is the part of the total enemy HP they deal double damage to, in percent
+type AttributeCounter struct {
+	Attribute string
+	Against   []string
+	Share     int
+	Cards     []*Card
+	Leaders   []CounterLeader
+}
+
+// CounterView is the data of the counter template
+type CounterView struct {
+	Stage    *Stage
+	Owned    bool
+	Counters []AttributeCounter
+}
+
+// stageCounters groups enemies by the attribute strong against them, the most valuable first
+func stageCounters(enemies []StageEnemy) []AttributeCounter {
+	hp := make(map[string]int)
+	against := make(map[string][]string)
+	total := 0
+	for _, enemy := range enemies {
+		total += enemy.Hp
+		counter, ok := attributeCounters[enemy.Attribute]
+		if !ok {
+			continue
+		}
+		if _, seen := hp[counter]; !seen {
+			against[counter] = append(against[counter], enemy.Attribute)
+		}
+		hp[counter] += enemy.Hp
+	}
+	var counters []AttributeCounter
+	for _, attribute := range cardAttributes {
+		if _, ok := hp[attribute]; !ok {
+			continue
+		}
+		counter := AttributeCounter{Attribute: attribute, Against: against[attribute]}
+		if total > 0 {
+			counter.Share = hp[attribute] * 100 / total
+		}
+		counters = append(counters, counter)
+	}
+	sort.SliceStable(counters, func(i, j int) bool {
+		return counters[i].Share > counters[j].Share
+	})
+	return counters
+}
+
+// fillCounterCards picks the strongest attackers and leaders of every counter attribute
+func fillCounterCards(counters []AttributeCounter, cards []*Card) {
+	sort.SliceStable(cards, func(i, j int) bool {
+		return cards[i].Max_attk > cards[j].Max_attk
+	})
+	for i := range counters {
+		counter := &counters[i]
+		// a card of the attribute without a race, so only attribute and global boosts count
+		sample := &Card{Attribute: counter.Attribute}
+		for _, card := range cards {
+			if card.Attribute != counter.Attribute {
+				continue
+			}
+			if len(counter.Cards) < COUNTER_MAX_CARDS {
+				counter.Cards = append(counter.Cards, card)
+			}
+			if card.LeaderSkill == nil {
+				continue
+			}
+			multiplier := leaderMultiplier(parseLeaderSkill(card.LeaderSkill.Effect), sample, LEADER_STAT_ATTACK, false)
+			if multiplier > 1 {
+				counter.Leaders = append(counter.Leaders, CounterLeader{Card: card, Multiplier: multiplier})
+			}
+		}
+		sort.SliceStable(counter.Leaders, func(i, j int) bool {
+			return counter.Leaders[i].Multiplier > counter.Leaders[j].Multiplier
+		})
+		if len(counter.Leaders) > COUNTER_MAX_LEADERS {
+			counter.Leaders = counter.Leaders[:COUNTER_MAX_LEADERS]
+		}
+	}
+}
+
+// Counter handles /counter [stage] and /counter [stage] own, the latter uses only cards from the box
+func (command *Command) Counter(api Sender, params string) error {
+	words := strings.Fields(params)
+	owned := len(words) > 1 && words[len(words)-1] == "own"
+	if owned {
+		words = words[:len(words)-1]
+	}
+	if len(words) == 0 {
+		return send(api, command.NewMessage(command.tr("counter_usage")))
+	}
+	stage, err := findStage(strings.Join(words, " "))
+	if err != nil {
+		return err
+	}
+	if stage == nil {
+		return send(api, command.NewMessage(command.tr("stage_not_found")))
+	}
+	enemies, err := stageEnemies(stage.Id)
+	if err != nil {
+		return err
+	}
+	view := &CounterView{Stage: stage, Owned: owned, Counters: stageCounters(enemies)}
+	if len(view.Counters) > 0 {
+		attributes := make([]string, len(view.Counters))
+		for i, counter := range view.Counters {
+			attributes[i] = counter.Attribute
+		}
+		ownerId := 0
+		if owned {
+			ownerId = command.fromUser().ID
+		}
+		cards, err := cardStore.CardsOfAttributes(attributes, ownerId)
+		if err != nil {
+			return err
+		}
+		fillCounterCards(view.Counters, cards)
+	}
+	res, err := renderTemplate(TEMPLATE_COUNTER, command.lang(), view)
+	if err != nil {
+		return err
+	}
+	for _, part := range splitMessage(res) {
+		msg := command.NewMessage(part)
+		msg.DisableWebPagePreview = true
+		if err := send(api, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const DISPATCHER_DEFAULT_WORKERS = 8
+
+// updates waiting for a busy worker, when the queue is full reading of new updates waits
+const DISPATCHER_DEFAULT_QUEUE = 100
+
+// updateDispatcher handles updates concurrently. Updates of a chat always go to the same worker,
+// so they are handled in the order they came in.
+type updateDispatcher struct {
+	queues []chan tgbotapi.Update
+	wg     sync.WaitGroup
+}
+
+// newUpdateDispatcher starts [bot] workers workers, each with a queue of [bot] queue updates
+func newUpdateDispatcher(api Sender) *updateDispatcher {
+	workers := config.Section("bot").Key("workers").MustInt(DISPATCHER_DEFAULT_WORKERS)
+	if workers < 1 {
+		workers = 1
+	}
+	size := config.Section("bot").Key("queue").MustInt(DISPATCHER_DEFAULT_QUEUE)
+	dispatcher := &updateDispatcher{queues: make([]chan tgbotapi.Update, workers)}
+	for i := range dispatcher.queues {
+		queue := make(chan tgbotapi.Update, size)
+		dispatcher.queues[i] = queue
+		dispatcher.wg.Add(1)
+		go func() {
+			defer dispatcher.wg.Done()
+			for update := range queue {
+				handleUpdate(api, update)
+			}
+		}()
+	}
+	return dispatcher
+}
+
+// updateChatId returns the chat the update belongs to. Inline queries
+// and callbacks of inline messages have no chat, the user is used instead.
+func updateChatId(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.EditedMessage != nil:
+		return update.EditedMessage.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return update.CallbackQuery.Message.Chat.ID
+	case update.CallbackQuery != nil:
+		return int64(update.CallbackQuery.From.ID)
+	case update.InlineQuery != nil:
+		return int64(update.InlineQuery.From.ID)
+	case update.ChosenInlineResult != nil:
+		return int64(update.ChosenInlineResult.From.ID)
+	}
+	return 0
+}
+
+// dispatch queues the update for the worker of its chat, it waits while the queue is full
+func (dispatcher *updateDispatcher) dispatch(update tgbotapi.Update) {
+	chatId := updateChatId(update)
+	if chatId < 0 {
+		chatId = -chatId
+	}
+	dispatcher.queues[chatId%int64(len(dispatcher.queues))] <- update
+}
+
+// run dispatches updates until stopped is closed, updates received before are dispatched too
+func (dispatcher *updateDispatcher) run(updates tgbotapi.UpdatesChannel, stopped chan struct{}) {
+	for {
+		select {
+		case update := <-updates:
+			dispatcher.dispatch(update)
+		case <-stopped:
+			for {
+				select {
+				case update := <-updates:
+					dispatcher.dispatch(update)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// stop waits until all queued updates are handled
+func (dispatcher *updateDispatcher) stop() {
+	for _, queue := range dispatcher.queues {
+		close(queue)
+	}
+	dispatcher.wg.Wait()
+}
+
+// stopOnSignal stops receiving updates on SIGTERM or interrupt and closes the returned channel.
+// The webhook server waits for its requests, so run has to keep reading updates meanwhile.
+func stopOnSignal(bot *tgbotapi.BotAPI, server *http.Server) chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	stopped := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.Printf("Got %v, finishing received updates", sig)
+		if server != nil {
+			err := server.Shutdown(context.Background())
+			if err != nil {
+				log.Printf("[Error] Can`t stop webhook server: %v", err)
+			}
+		} else {
+			bot.StopReceivingUpdates()
+		}
+		close(stopped)
+	}()
+	return stopped
+}
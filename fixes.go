@@ -0,0 +1,382 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const FIX_STATUS_PENDING = 0
+const FIX_STATUS_APPROVED = 1
+const FIX_STATUS_REJECTED = 2
+
+const FIX_TARGET_CARD = 0
+const FIX_TARGET_ACTIVE_SKILL = 1
+const FIX_TARGET_LEADER_SKILL = 2
+
+type fixableField struct {
+	Column  string
+	Target  int
+	Numeric bool
+}
+
+// fields which can be corrected with /fix, keyed by the name users type
+var fixableFields = map[string]fixableField{
+	"name":          {"name", FIX_TARGET_CARD, false},
+	"attribute":     {"attribute", FIX_TARGET_CARD, false},
+	"rarity":        {"rarity", FIX_TARGET_CARD, true},
+	"cost":          {"cost", FIX_TARGET_CARD, true},
+	"race":          {"race", FIX_TARGET_CARD, false},
+	"series":        {"series", FIX_TARGET_CARD, false},
+	"max_exp":       {"max_exp", FIX_TARGET_CARD, true},
+	"hp":            {"max_hp", FIX_TARGET_CARD, true},
+	"attack":        {"max_attk", FIX_TARGET_CARD, true},
+	"recovery":      {"max_rec", FIX_TARGET_CARD, true},
+	"total":         {"total_stats", FIX_TARGET_CARD, true},
+	"active_name":   {"name", FIX_TARGET_ACTIVE_SKILL, false},
+	"active_effect": {"effect", FIX_TARGET_ACTIVE_SKILL, false},
+	"active_cd":     {"lv1cd", FIX_TARGET_ACTIVE_SKILL, true},
+	"active_max_cd": {"lvmaxcd", FIX_TARGET_ACTIVE_SKILL, true},
+	"leader_name":   {"name", FIX_TARGET_LEADER_SKILL, false},
+	"leader_effect": {"effect", FIX_TARGET_LEADER_SKILL, false},
+}
+
+type CardFix struct {
+	Id         int
+	CardId     string
+	Field      string
+	Value      string
+	OldValue   string
+	UserId     int
+	UserName   string
+	ChatId     int64
+	Status     int
+	ReviewedBy int
+	Created    time.Time
+}
+
+// CardOverride keeps approved corrections, they are applied again after every catalog import
+type CardOverride struct {
+	CardId  string `sql:",pk"`
+	Field   string `sql:",pk"`
+	Value   string
+	FixId   int
+	Updated time.Time
+}
+
+func (fix *CardFix) Format(lang string) string {
+	return tr(lang, "fix_line", fix.Id, fix.CardId, html.EscapeString(fix.UserName), fix.Field,
+		html.EscapeString(fix.OldValue), html.EscapeString(fix.Value))
+}
+
+// fixableFieldNames returns the list of fields for the help message
+func fixableFieldNames() string {
+	names := make([]string, 0, len(fixableFields))
+	for name := range fixableFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// fixQuery returns a query limited to the card or skill row the field belongs to
+func fixQuery(db orm.DB, cardId string, field fixableField) *orm.Query {
+	switch field.Target {
+	case FIX_TARGET_ACTIVE_SKILL:
+		return db.Model((*Skill)(nil)).Where("id = (SELECT active_skill_id FROM cards WHERE card_id = ?)", cardId)
+	case FIX_TARGET_LEADER_SKILL:
+		return db.Model((*Skill)(nil)).Where("id = (SELECT leader_skill_id FROM cards WHERE card_id = ?)", cardId)
+	default:
+		return db.Model((*Card)(nil)).Where("card_id = ?", cardId)
+	}
+}
+
+// applyCardFix writes a single corrected value into the cards table. Skills are shared
+// by cards and matched by name on import, so their corrections stay in card_overrides
+// and are applied when cards are read, see applySkillOverrides.
+func applyCardFix(db orm.DB, cardId string, name string, value string) error {
+	field, ok := fixableFields[name]
+	if !ok {
+		return fmt.Errorf("Unknown field %v", name)
+	}
+	if field.Target != FIX_TARGET_CARD {
+		return nil
+	}
+	var typed interface{} = value
+	if field.Numeric {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		typed = number
+	}
+	_, err := fixQuery(db, cardId, field).Set("? = ?", pg.F(field.Column), typed).Update()
+	return err
+}
+
+// setSkillField sets the corrected column of the skill
+func setSkillField(skill *Skill, column string, value string) {
+	switch column {
+	case "name":
+		skill.Name = value
+	case "effect":
+		skill.Effect = value
+	case "lv1cd":
+		skill.Lv1cd, _ = strconv.Atoi(value)
+	case "lvmaxcd":
+		skill.Lvmaxcd, _ = strconv.Atoi(value)
+	}
+}
+
+// applySkillOverrides applies approved skill corrections to the loaded cards. The skills
+// are copied first, so a correction changes only the card it was proposed for.
+func applySkillOverrides(db orm.DB, cards []*Card) error {
+	if len(cards) == 0 {
+		return nil
+	}
+	var fields []string
+	for name, field := range fixableFields {
+		if field.Target != FIX_TARGET_CARD {
+			fields = append(fields, name)
+		}
+	}
+	byId := make(map[string][]*Card)
+	ids := make([]string, 0, len(cards))
+	for _, card := range cards {
+		byId[card.Card_id] = append(byId[card.Card_id], card)
+		ids = append(ids, card.Card_id)
+	}
+	var overrides []CardOverride
+	err := db.Model(&overrides).
+		Where("card_id IN (?)", pg.In(ids)).
+		Where("field IN (?)", pg.In(fields)).
+		Order("updated").
+		Select()
+	if err != nil {
+		return err
+	}
+	for _, override := range overrides {
+		field, ok := fixableFields[override.Field]
+		if !ok {
+			continue
+		}
+		for _, card := range byId[override.CardId] {
+			target := &card.ActiveSkill
+			if field.Target == FIX_TARGET_LEADER_SKILL {
+				target = &card.LeaderSkill
+			}
+			if *target == nil {
+				continue
+			}
+			skill := **target
+			setSkillField(&skill, field.Column, override.Value)
+			*target = &skill
+		}
+	}
+	return nil
+}
+
+// applyCardOverrides restores all approved corrections, called after the catalog import
+func applyCardOverrides(db orm.DB) error {
+	var overrides []CardOverride
+	err := db.Model(&overrides).Order("updated").Select()
+	if err != nil {
+		return err
+	}
+	for _, override := range overrides {
+		ferr := applyCardFix(db, override.CardId, override.Field, override.Value)
+		if ferr != nil {
+			log.Printf("[Error] Can`t apply override of %v for card %v: %v", override.Field, override.CardId, ferr)
+		}
+	}
+	return nil
+}
+
+// fixReviewChats returns where proposed corrections are sent: the admin chat or every bot admin
+func fixReviewChats() []int64 {
+	if adminChatId != 0 {
+		return []int64{adminChatId}
+	}
+	chats := make([]int64, 0, len(botAdmins))
+	for id := range botAdmins {
+		chats = append(chats, int64(id))
+	}
+	return chats
+}
+
+func (command *Command) ProposeFix(api Sender, params string) error {
+	usage := command.tr("fix_usage", fixableFieldNames())
+	words := strings.Fields(params)
+	if len(words) == 0 {
+		return command.startConversation(api, "fix", "")
+	}
+	if len(words) < 2 {
+		return send(api, command.NewMessage(usage))
+	}
+	assignment := strings.Join(words[1:], " ")
+	eq := strings.Index(assignment, "=")
+	if eq <= 0 {
+		return send(api, command.NewMessage(usage))
+	}
+	name := strings.ToLower(strings.TrimSpace(assignment[:eq]))
+	value := strings.TrimSpace(assignment[eq+1:])
+	field, ok := fixableFields[name]
+	if !ok || value == "" {
+		return send(api, command.NewMessage(usage))
+	}
+	if _, err := strconv.Atoi(value); field.Numeric && err != nil {
+		return send(api, command.NewMessage(command.tr("fix_not_number", name)))
+	}
+	var oldValue string
+	err := fixQuery(session, words[0], field).ColumnExpr("?::text", pg.F(field.Column)).Limit(1).Select(pg.Scan(&oldValue))
+	if err == nil && field.Target != FIX_TARGET_CARD {
+		// skill corrections are not written into skills, the current value may be an override
+		override := CardOverride{CardId: words[0], Field: name}
+		oerr := session.Select(&override)
+		if oerr == nil {
+			oldValue = override.Value
+		} else if oerr != pg.ErrNoRows {
+			return oerr
+		}
+	}
+	if err == pg.ErrNoRows && field.Target != FIX_TARGET_CARD {
+		// the card may exist without a skill of this kind
+		exists, cerr := session.Model((*Card)(nil)).Where("card_id = ?", words[0]).Exists()
+		if cerr != nil {
+			return cerr
+		}
+		if exists {
+			return send(api, command.NewMessage(command.tr("fix_no_skill", name)))
+		}
+	}
+	if err == pg.ErrNoRows {
+		return send(api, command.NewMessage(command.tr("card_not_found")))
+	} else if err != nil {
+		return err
+	}
+
+	message := command.tgRequest.Message
+	fix := CardFix{
+		CardId:   words[0],
+		Field:    name,
+		Value:    value,
+		OldValue: oldValue,
+		UserId:   message.From.ID,
+		UserName: userDisplayName(message.From),
+		ChatId:   message.Chat.ID,
+		Status:   FIX_STATUS_PENDING,
+		Created:  time.Now(),
+	}
+	ierr := session.Insert(&fix)
+	if ierr != nil {
+		return ierr
+	}
+	for _, chatId := range fixReviewChats() {
+		lang := chatLanguageOrDefault(chatId)
+		approve, aerr := command.queryButton(tr(lang, "fix_button_approve"), strconv.Itoa(fix.Id), "approve")
+		if aerr != nil {
+			return aerr
+		}
+		reject, rerr := command.queryButton(tr(lang, "fix_button_reject"), strconv.Itoa(fix.Id), "reject")
+		if rerr != nil {
+			return rerr
+		}
+		markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(approve, reject))
+		msg := tgbotapi.NewMessage(chatId, fix.Format(lang))
+		msg.ParseMode = "HTML"
+		msg.ReplyMarkup = markup
+		if err := send(api, msg); err != nil {
+			// the fix is saved, other admins can still review it
+			log.Printf("[Error] Can`t send fix %v to chat %v: %v", fix.Id, chatId, err)
+		}
+	}
+	return send(api, command.NewMessage(command.tr("fix_sent", fix.Id)))
+}
+
+// fixFlow asks for the card, the field and the value when /fix is sent without parameters
+var fixFlow = &conversationFlow{
+	steps: []conversationStep{
+		{ask("fix_ask_card"), checkCardIds(1)},
+		{
+			func(command *Command) string { return command.tr("fix_ask_field", fixableFieldNames()) },
+			checkFixField,
+		},
+		{ask("fix_ask_value"), checkAnything},
+	},
+	finish: func(command *Command, api Sender, params string, answers []string) error {
+		return command.ProposeFix(api, fmt.Sprintf("%v %v=%v", answers[0], answers[1], answers[2]))
+	},
+}
+
+func checkFixField(command *Command, answer string) (string, string, error) {
+	name := strings.ToLower(answer)
+	if _, ok := fixableFields[name]; !ok {
+		return "", command.tr("fix_unknown_field"), nil
+	}
+	return name, "", nil
+}
+
+// reviewFix handles approve/reject buttons, the first admin to answer wins
+func (command *Command) reviewFix(api Sender, query *tgbotapi.CallbackQuery, fixId int, action string) error {
+	fix := CardFix{Id: fixId}
+	status := FIX_STATUS_REJECTED
+	if action == "approve" {
+		status = FIX_STATUS_APPROVED
+	}
+	err := session.RunInTransaction(func(tx *pg.Tx) error {
+		res, err := tx.Model(&fix).
+			Set("status = ?, reviewed_by = ?", status, query.From.ID).
+			Where("id = ?id AND status = ?", FIX_STATUS_PENDING).
+			Returning("*").
+			Update()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 || status == FIX_STATUS_REJECTED {
+			return nil
+		}
+		ferr := applyCardFix(tx, fix.CardId, fix.Field, fix.Value)
+		if ferr != nil {
+			return ferr
+		}
+		override := CardOverride{CardId: fix.CardId, Field: fix.Field, Value: fix.Value, FixId: fix.Id, Updated: time.Now()}
+		_, oerr := tx.Model(&override).
+			OnConflict("(card_id, field) DO UPDATE").
+			Set("value = EXCLUDED.value, fix_id = EXCLUDED.fix_id, updated = EXCLUDED.updated").
+			Insert()
+		return oerr
+	})
+	if err != nil {
+		answerCallback(api, query.ID, command.tr("service_unavailable"))
+		return err
+	}
+	if fix.Status != status {
+		answerCallback(api, query.ID, command.tr("fix_already_reviewed"))
+		return nil
+	}
+
+	result, notice := "fix_rejected", "fix_rejected_notice"
+	if status == FIX_STATUS_APPROVED {
+		result, notice = "fix_approved", "fix_approved_notice"
+	}
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID,
+		fmt.Sprintf("%v\n\n%v (%v)", fix.Format(command.lang()), command.tr(result), html.EscapeString(userDisplayName(query.From))))
+	edit.ParseMode = "HTML"
+	if err := send(api, edit); err != nil {
+		return err
+	}
+	// the author could leave the chat or block the bot, the review is done anyway
+	if nerr := send(api, tgbotapi.NewMessage(fix.ChatId, tr(chatLanguageOrDefault(fix.ChatId), notice, fix.Id, fix.CardId))); nerr != nil {
+		log.Printf("[Error] Can`t notify about fix %v: %v", fix.Id, nerr)
+	}
+	answerCallback(api, query.ID, command.tr(result))
+	return nil
+}
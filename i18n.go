@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+const DEFAULT_LANGUAGE = "ru"
+
+var supportedLanguages = []string{"ru", "en", "zh"}
+
+// ChatLanguage is the language chosen with /lang, in private chats it is the user's choice
+type ChatLanguage struct {
+	ChatId   int64 `sql:",pk"`
+	Language string
+}
+
+type LanguageCache struct {
+	mx    sync.Mutex
+	value map[int64]string
+}
+
+var chatLanguages = LanguageCache{value: make(map[int64]string)}
+
+// normalizeLanguage turns telegram language codes like "en-US" or "zh-hans" into a supported language
+func normalizeLanguage(code string) (string, bool) {
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	for _, lang := range supportedLanguages {
+		if code == lang {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+// chatLanguage returns the language selected for the chat, "" when none was selected
+func chatLanguage(chatId int64) string {
+	chatLanguages.mx.Lock()
+	defer chatLanguages.mx.Unlock()
+	lang, ok := chatLanguages.value[chatId]
+	if ok {
+		return lang
+	}
+	lang, err := chatStore.ChatLanguage(chatId)
+	if err != nil {
+		log.Printf("[Error] Can`t load language of chat %v: %v", chatId, err)
+		return ""
+	}
+	chatLanguages.value[chatId] = lang
+	return lang
+}
+
+// chatLanguageOrDefault is used for messages sent without a user request, e.g. by schedulers
+func chatLanguageOrDefault(chatId int64) string {
+	if lang := chatLanguage(chatId); lang != "" {
+		return lang
+	}
+	return DEFAULT_LANGUAGE
+}
+
+// tr formats the message with the given key in the given language
+func tr(lang string, key string, args ...interface{}) string {
+	format, ok := messages[lang][key]
+	if !ok {
+		format, ok = messages[DEFAULT_LANGUAGE][key]
+	}
+	if !ok {
+		log.Printf("[Error] Missing message %q", key)
+		return key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// lang picks the chat language, then the language of the user's telegram client
+func (command *Command) lang() string {
+	if command.language != "" {
+		return command.language
+	}
+	command.language = DEFAULT_LANGUAGE
+	if lang := chatLanguage(command.chatId()); lang != "" {
+		command.language = lang
+	} else if lang, ok := normalizeLanguage(command.fromUser().LanguageCode); ok {
+		command.language = lang
+	}
+	return command.language
+}
+
+func (command *Command) tr(key string, args ...interface{}) string {
+	return tr(command.lang(), key, args...)
+}
+
+func (command *Command) SetLanguage(api Sender, params string) error {
+	lang, ok := normalizeLanguage(strings.TrimSpace(params))
+	if !ok {
+		return send(api, command.NewMessage(command.tr("lang_usage", command.lang())))
+	}
+	if !command.hasPermission(api, PERMISSION_CHAT_ADMIN) {
+		return send(api, command.NewMessage(command.tr("no_permission_command")))
+	}
+	err := chatStore.SetChatLanguage(command.chatId(), lang)
+	if err != nil {
+		return err
+	}
+	chatLanguages.mx.Lock()
+	chatLanguages.value[command.chatId()] = lang
+	chatLanguages.mx.Unlock()
+	command.language = lang
+	return send(api, command.NewMessage(command.tr("lang_set")))
+}
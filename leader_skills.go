@@ -0,0 +1,227 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const LEADER_STAT_HP = 0
+const LEADER_STAT_ATTACK = 1
+const LEADER_STAT_RECOVERY = 2
+
+var cardAttributes = []string{"Water", "Fire", "Earth", "Light", "Dark"}
+var cardRaces = []string{"Human", "Dragon", "Beast", "Elf", "God", "Demon", "Machina"}
+
+// wordAliases are forms of the words which are not made by adding "s"
+var wordAliases = map[string][]string{
+	"Elf": {"Elves", "Elven"},
+}
+
+var attributeRes = wordRes(cardAttributes)
+var raceRes = wordRes(cardRaces)
+
+var leaderSentenceRe = regexp.MustCompile(`\.(?:\s+|$)|;|\n`)
+var leaderMultiplierRe = regexp.MustCompile(`(?i)(?:\bx|×|\*)\s*(\d+(?:\.\d+)?)`)
+var leaderConditionRe = regexp.MustCompile(`(?i)\b(?:when|if|for each|during|after|while|per)\b`)
+var leaderStatRes = map[int]*regexp.Regexp{
+	LEADER_STAT_HP:       regexp.MustCompile(`(?i)\b(?:hp|health)\b`),
+	LEADER_STAT_ATTACK:   regexp.MustCompile(`(?i)\b(?:attack|atk)\b`),
+	LEADER_STAT_RECOVERY: regexp.MustCompile(`(?i)\b(?:recovery|rec)\b`),
+}
+
+// LeaderEffect is a single boost of a leader skill, e.g. "Water Attack x 2".
+// Empty Attribute and Race mean the boost applies to all cards,
+// Condition keeps the text of the condition for conditional boosts.
+type LeaderEffect struct {
+	Stat       int
+	Attribute  string
+	Race       string
+	Multiplier float64
+	Condition  string
+}
+
+func (effect *LeaderEffect) Applies(card *Card) bool {
+	switch {
+	case effect.Attribute != "":
+		return strings.EqualFold(card.Attribute, effect.Attribute)
+	case effect.Race != "":
+		return strings.EqualFold(card.Race, effect.Race)
+	}
+	return true
+}
+
+// Target is the attribute or race the boost is limited to, "" for all cards
+func (effect *LeaderEffect) Target() string {
+	if effect.Attribute != "" {
+		return effect.Attribute
+	}
+	return effect.Race
+}
+
+// wordRes compiles case insensitive patterns of the words, plural forms and aliases included
+func wordRes(words []string) map[string]*regexp.Regexp {
+	res := make(map[string]*regexp.Regexp)
+	for _, word := range words {
+		forms := append([]string{word}, wordAliases[word]...)
+		res[word] = regexp.MustCompile(`(?i)\b(?:` + strings.Join(forms, "|") + `)s?\b`)
+	}
+	return res
+}
+
+// findWords returns words of the list mentioned in the text
+func findWords(text string, words []string, res map[string]*regexp.Regexp) []string {
+	var found []string
+	for _, word := range words {
+		if res[word].MatchString(text) {
+			found = append(found, word)
+		}
+	}
+	return found
+}
+
+// splitCondition separates the condition clause ("when HP is above 80%")
+// from the rest of the sentence, which holds the boosts
+func splitCondition(sentence string) (string, string) {
+	loc := leaderConditionRe.FindStringIndex(sentence)
+	if loc == nil {
+		return "", sentence
+	}
+	end := strings.Index(sentence[loc[0]:], ",")
+	if end < 0 {
+		return strings.TrimSpace(sentence[loc[0]:]), sentence[:loc[0]]
+	}
+	end += loc[0]
+	return strings.TrimSpace(sentence[loc[0]:end]), sentence[:loc[0]] + sentence[end+1:]
+}
+
+// parseLeaderSkill turns the free text of a leader skill into boosts.
+// Parts of the text which can't be understood are skipped.
+func parseLeaderSkill(text string) []LeaderEffect {
+	var effects []LeaderEffect
+	for _, sentence := range leaderSentenceRe.Split(text, -1) {
+		condition, rest := splitCondition(sentence)
+		// a part without a multiplier belongs to the next one: "HP, Attack and Recovery x 1.5"
+		part := ""
+		for _, piece := range strings.Split(rest, ",") {
+			part += piece + ","
+			match := leaderMultiplierRe.FindStringSubmatchIndex(part)
+			if match == nil {
+				continue
+			}
+			multiplier, err := strconv.ParseFloat(part[match[2]:match[3]], 64)
+			if err != nil || multiplier <= 0 {
+				part = ""
+				continue
+			}
+			attributes := findWords(part, cardAttributes, attributeRes)
+			races := findWords(part, cardRaces, raceRes)
+			if len(attributes) == 0 && len(races) == 0 {
+				attributes = findWords(rest, cardAttributes, attributeRes)
+				races = findWords(rest, cardRaces, raceRes)
+			}
+			var stats []int
+			for stat := LEADER_STAT_HP; stat <= LEADER_STAT_RECOVERY; stat++ {
+				if leaderStatRes[stat].MatchString(part) {
+					stats = append(stats, stat)
+				}
+			}
+			if len(stats) == 0 {
+				stats = []int{LEADER_STAT_ATTACK}
+			}
+			for _, stat := range stats {
+				base := LeaderEffect{Stat: stat, Multiplier: multiplier, Condition: condition}
+				if len(attributes) == 0 && len(races) == 0 {
+					effects = append(effects, base)
+				}
+				for _, attribute := range attributes {
+					effect := base
+					effect.Attribute = attribute
+					effects = append(effects, effect)
+				}
+				for _, race := range races {
+					effect := base
+					effect.Race = race
+					effects = append(effects, effect)
+				}
+			}
+			part = ""
+		}
+	}
+	return effects
+}
+
+// leaderMultiplier multiplies boosts of the stat which apply to the card.
+// Conditional boosts are counted only if withConditions is set.
+func leaderMultiplier(effects []LeaderEffect, card *Card, stat int, withConditions bool) float64 {
+	multiplier := 1.0
+	for i := range effects {
+		effect := &effects[i]
+		if effect.Stat != stat || !effect.Applies(card) || (effect.Condition != "" && !withConditions) {
+			continue
+		}
+		multiplier *= effect.Multiplier
+	}
+	return multiplier
+}
+
+// AttributeAttack is the attack of team cards of one attribute
+type AttributeAttack struct {
+	Attribute string
+	Attack    int
+	MaxAttack int
+}
+
+// TeamEstimate is the team with both leader skills applied.
+// MaxAttack counts conditional boosts as fulfilled.
+type TeamEstimate struct {
+	Effects  []LeaderEffect
+	Hp       int
+	Recovery int
+	Attack   []AttributeAttack
+}
+
+func (estimate *TeamEstimate) HasConditions() bool {
+	for _, effect := range estimate.Effects {
+		if effect.Condition != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// newTeamEstimate applies leader skills of the leader and the friend to the team
+func newTeamEstimate(leader *Card, friend *Card, cards []*Card) *TeamEstimate {
+	estimate := &TeamEstimate{}
+	for _, card := range []*Card{leader, friend} {
+		if card.LeaderSkill != nil {
+			estimate.Effects = append(estimate.Effects, parseLeaderSkill(card.LeaderSkill.Effect)...)
+		}
+	}
+	attack := make(map[string]*AttributeAttack)
+	for _, card := range cards {
+		estimate.Hp += int(float64(card.Max_hp) * leaderMultiplier(estimate.Effects, card, LEADER_STAT_HP, false))
+		estimate.Recovery += int(float64(card.Max_rec) * leaderMultiplier(estimate.Effects, card, LEADER_STAT_RECOVERY, false))
+		row, ok := attack[card.Attribute]
+		if !ok {
+			row = &AttributeAttack{Attribute: card.Attribute}
+			attack[card.Attribute] = row
+		}
+		row.Attack += int(float64(card.Max_attk) * leaderMultiplier(estimate.Effects, card, LEADER_STAT_ATTACK, false))
+		row.MaxAttack += int(float64(card.Max_attk) * leaderMultiplier(estimate.Effects, card, LEADER_STAT_ATTACK, true))
+	}
+	// known attributes go first in the game order
+	for _, attribute := range cardAttributes {
+		if row, ok := attack[attribute]; ok {
+			estimate.Attack = append(estimate.Attack, *row)
+			delete(attack, attribute)
+		}
+	}
+	for _, card := range cards {
+		if row, ok := attack[card.Attribute]; ok {
+			estimate.Attack = append(estimate.Attack, *row)
+			delete(attack, card.Attribute)
+		}
+	}
+	return estimate
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLeaderSkill(t *testing.T) {
+	tests := []struct {
+		text    string
+		effects []LeaderEffect
+	}{
+		{"Water Attack x 2.5.", []LeaderEffect{
+			{Stat: LEADER_STAT_ATTACK, Attribute: "Water", Multiplier: 2.5},
+		}},
+		{"Elves Attack x 2.", []LeaderEffect{
+			{Stat: LEADER_STAT_ATTACK, Race: "Elf", Multiplier: 2},
+		}},
+		{"Elven Attack x 2.2", []LeaderEffect{
+			{Stat: LEADER_STAT_ATTACK, Race: "Elf", Multiplier: 2.2},
+		}},
+		{"Dragons HP x 1.5, Attack x 2.", []LeaderEffect{
+			{Stat: LEADER_STAT_HP, Race: "Dragon", Multiplier: 1.5},
+			{Stat: LEADER_STAT_ATTACK, Race: "Dragon", Multiplier: 2},
+		}},
+		{"Gods and Demons Attack x 2.", []LeaderEffect{
+			{Stat: LEADER_STAT_ATTACK, Race: "God", Multiplier: 2},
+			{Stat: LEADER_STAT_ATTACK, Race: "Demon", Multiplier: 2},
+		}},
+		{"Fire Attack x 3. Fire HP x 1.2", []LeaderEffect{
+			{Stat: LEADER_STAT_ATTACK, Attribute: "Fire", Multiplier: 3},
+			{Stat: LEADER_STAT_HP, Attribute: "Fire", Multiplier: 1.2},
+		}},
+		{"HP, Attack and Recovery x 1.5", []LeaderEffect{
+			{Stat: LEADER_STAT_HP, Multiplier: 1.5},
+			{Stat: LEADER_STAT_ATTACK, Multiplier: 1.5},
+			{Stat: LEADER_STAT_RECOVERY, Multiplier: 1.5},
+		}},
+		{"Team Attack x 2 when HP is above 80%", []LeaderEffect{
+			{Stat: LEADER_STAT_ATTACK, Multiplier: 2, Condition: "when HP is above 80%"},
+		}},
+	}
+	for _, test := range tests {
+		effects := parseLeaderSkill(test.text)
+		if !reflect.DeepEqual(effects, test.effects) {
+			t.Errorf("parseLeaderSkill(%q) = %+v, want %+v", test.text, effects, test.effects)
+		}
+	}
+}
+
+func TestLeaderMultiplierRace(t *testing.T) {
+	effects := parseLeaderSkill("Elves Attack x 2.")
+	if m := leaderMultiplier(effects, &Card{Race: "Elf"}, LEADER_STAT_ATTACK, false); m != 2 {
+		t.Errorf("multiplier of an elf = %v, want 2", m)
+	}
+	if m := leaderMultiplier(effects, &Card{Race: "Human"}, LEADER_STAT_ATTACK, false); m != 1 {
+		t.Errorf("multiplier of a human = %v, want 1", m)
+	}
+}
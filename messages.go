@@ -0,0 +1,471 @@
+package main
+
+// messages is the catalog of bot replies, keyed by language and message key.
+// Values are fmt formats, a missing key falls back to DEFAULT_LANGUAGE.
+var messages = map[string]map[string]string{
+	"ru": {
+		"no_permission_command": "У вас недостаточно прав для этой комманды",
+		"no_permission_action":  "У вас нет прав для этого действия",
+		"service_unavailable":   "Ошибка. Сервис недоступен",
+		"button_ok":             "✅ Ок",
+		"button_cancel":         "🚫 Отменить",
+		"lang_usage":            "Формат: /lang [ru|en|zh]. Текущий язык: %v",
+		"lang_set":              "Язык изменён на русский 🇷🇺",
+
+		"card_name_too_short": "Имя карты должно быть чуть длиннее 😔",
+		"card_not_found":      "Простите, мне не удалось найти такую карту 😢",
+
+		"poll_vote_for":        "👍 За",
+		"poll_vote_against":    "👎 Против",
+		"poll_choose":          "Выберите 1 из вариантов:",
+		"poll_choose_public":   "Выберите 1 из вариантов (открытое голосование, участники будут видны всем):",
+		"poll_button_close":    "🔒 Завершить",
+		"poll_button_voters":   "👥 Кто голосовал",
+		"poll_closed_title":    "<b>Голосование завершено</b>",
+		"poll_total":           "Всего голосов: %v",
+		"poll_no_votes":        "Никто не проголосовал 😔",
+		"poll_tie":             "Результат: ничья",
+		"poll_winner":          "Победил вариант: <b>%v</b>",
+		"poll_not_reply":       "Комманда должна быть ответом на сообщение с голосованием 😔",
+		"poll_not_poll":        "Это сообщение не является голосованием 😔",
+		"poll_close_forbidden": "Только автор или администратор может завершить голосование",
+		"poll_already_closed":  "Голосование уже завершено",
+		"poll_closed":          "Голосование завершено",
+		"poll_anonymous":       "Это анонимное голосование",
+		"poll_results":         "Результаты голосования:",
+		"poll_already_voted":   "Вы уже голосовали в этом опросе",
+		"poll_vote_accepted":   "Спасибо, ваш голос учтен",
+
+		"reminder_saved":     "Готово 👌\n%v",
+		"remind_usage":       "Формат: /remind [30m | 18:30 | 31.12 18:30] [текст]",
+		"announce_usage":     "Формат: /announce daily 09:00 [текст] или /announce weekly sun 20:00 [текст]",
+		"reminders_empty":    "В этом чате нет напоминаний",
+		"reminders_list":     "Напоминания:\n%v",
+		"unremind_usage":     "Формат: /unremind [id]",
+		"reminder_not_found": "Напоминание не найдено или создано другим пользователем",
+		"reminder_deleted":   "Напоминание удалено",
+		"reminder_daily":     "#%v ежедневно в %v — %v",
+		"reminder_weekly":    "#%v еженедельно (%v) в %v — %v",
+		"reminder_once":      "#%v %v — %v",
+		"weekday_0":          "вс",
+		"weekday_1":          "пн",
+		"weekday_2":          "вт",
+		"weekday_3":          "ср",
+		"weekday_4":          "чт",
+		"weekday_5":          "пт",
+		"weekday_6":          "сб",
+
+		"report_line":             "<b>#%v</b> %v%v от %v:\n%v",
+		"report_new":              "📝 Новое сообщение об ошибке\n%v",
+		"report_thanks":           "Спасибо! Ваше сообщение #%v передано администраторам 🙏",
+		"reports_empty":           "Открытых сообщений нет 🎉",
+		"resolve_usage":           "Формат: /resolve [id] [комментарий]",
+		"report_not_found":        "Сообщение #%v не найдено",
+		"report_already_resolved": "Сообщение #%v уже закрыто",
+		"report_resolved_notice":  "✅ %v, ваше сообщение #%v исправлено. Спасибо за помощь!",
+		"report_resolved":         "Сообщение #%v закрыто",
+
+		"templates_reload_failed": "Не удалось загрузить шаблоны: %v",
+		"templates_reloaded":      "Шаблоны обновлены 👌",
+		"import_started":          "Импорт карт начат...",
+		"import_failed":           "Ошибка импорта: %v",
+		"import_finished":         "Импорт завершен: %v карт, %v умений",
+		"stats_title":             "<b>Статистика</b>",
+		"stats_cards":             "Карт",
+		"stats_skills":            "Умений",
+		"stats_polls":             "Голосований",
+		"stats_active_polls":      "Активных голосований",
+		"stats_votes":             "Голосов",
+		"stats_reminders":         "Напоминаний",
+		"stats_open_reports":      "Открытых сообщений об ошибках",
+		"stats_banned":            "Заблокированных пользователей",
+		"ban_usage":               "Формат: /ban [user id] [причина] или ответ на сообщение пользователя",
+		"ban_admin":               "Нельзя заблокировать администратора",
+		"banned":                  "Пользователь %v заблокирован",
+		"unban_usage":             "Формат: /unban [user id] или ответ на сообщение пользователя",
+		"unbanned":                "Пользователь %v разблокирован",
+
+		"fix_line":             "<b>Исправление #%v</b> для карты [id:%v] от %v\n%v: <code>%v</code> → <code>%v</code>",
+		"fix_usage":            "Формат: /fix [id карты] [поле]=[значение]\nПоля: %v",
+		"fix_not_number":       "Значение поля %v должно быть числом",
+		"fix_no_skill":         "У этой карты нет навыка, к которому относится поле %v",
+		"fix_button_approve":   "✅ Принять",
+		"fix_button_reject":    "🚫 Отклонить",
+		"fix_sent":             "Спасибо! Исправление #%v отправлено на проверку 🙏",
+		"fix_already_reviewed": "Это исправление уже рассмотрено",
+		"fix_approved":         "✅ Принято",
+		"fix_rejected":         "🚫 Отклонено",
+		"fix_approved_notice":  "Ваше исправление #%v для карты [id:%v] принято. Спасибо! 🎉",
+		"fix_rejected_notice":  "Ваше исправление #%v для карты [id:%v] отклонено 😔",
+
+		"compare_usage":          "Формат: /compare [id] [id] [id], можно сравнить 2 или 3 карты",
+		"compare_card_not_found": "Карта [id:%v] не найдена 😢",
+
+		"team_usage":              "Формат: /team [лидер] [id] [id] [id] [id] [друг]\nСохранить: /team save [название] [6 id]\nПоказать сохранённую: /team [название]\nУдалить: /team delete [название]",
+		"team_card_not_found":     "Карта [id:%v] не найдена 😢",
+		"team_saved":              "Команда «%v» сохранена",
+		"team_deleted":            "Команда «%v» удалена",
+		"team_not_found":          "Команда не найдена. Ваши команды: /teams",
+		"teams_title":             "<b>Ваши команды:</b>",
+		"teams_empty":             "У вас нет сохранённых команд. Сохранить: /team save [название] [6 id]",
+		"team_button_share":       "📤 Поделиться",
+		"team_inline_description": "Карты: %v",
+
+		"dmg_usage": "Формат: /dmg [лидер] [id] [id] [id] [id] [друг] или /dmg [название сохранённой команды]",
+
+		"own_usage":   "Формат: /own add [id] [id]... или /own remove [id] [id]...",
+		"own_added":   "Добавлено карт в ящик: %v",
+		"own_removed": "Удалено карт из ящика: %v",
+		"own_unknown": "Не найдены карты: %v",
+		"box_empty":   "Ваш ящик пуст. Добавить карты: /own add [id] [id]...",
+		"box_title":   "<b>Ваш ящик, карт: %v</b>",
+		"box_more":    "...и ещё %v",
+
+		"group_only":          "Эта команда работает только в групповых чатах",
+		"whohas_usage":        "Формат: /whohas [id или название карты]",
+		"whohas_title":        "%v есть у:",
+		"whohas_nobody":       "%v нет ни у кого из участников чата. Карты добавляются командой /own add",
+		"roster_empty":        "Пока никто в этом чате не добавил карты в ящик. Команда: /own add [id] [id]...",
+		"roster_title":        "<b>Коллекция чата</b>: участников %v, разных карт %v",
+		"roster_by_attribute": "По атрибутам",
+		"roster_by_race":      "По расам",
+
+		"import_stages_finished": "Загружено подземелий: %v, врагов: %v",
+		"stage_usage":            "Формат: /stage [название подземелья]",
+		"stage_not_found":        "Подземелье не найдено 😢 Данные подземелий загружаются командой /import",
+
+		"counter_usage": "Формат: /counter [название подземелья], добавьте own в конце, чтобы выбирать только из карт вашего ящика",
+
+		"conversation_hint":          "<i>/back — вернуться к предыдущему вопросу, /cancel — отменить</i>",
+		"conversation_cancelled":     "Отменено",
+		"conversation_none":          "Сейчас нечего отменять",
+		"conversation_empty_answer":  "Ответ не может быть пустым",
+		"conversation_ids_count":     "Нужно указать карт: %v",
+		"conversation_ids_not_found": "Карты не найдены: %v",
+		"team_ask_leader":            "Id карты лидера?",
+		"team_ask_members":           "Id 4 карт команды через пробел?",
+		"team_ask_friend":            "Id карты друга?",
+		"team_ask_name":              "Название для сохранения команды? Отправьте -, чтобы не сохранять",
+		"fix_ask_card":               "Id карты, которую нужно исправить?",
+		"fix_ask_field":              "Какое поле исправить?\nПоля: %v",
+		"fix_unknown_field":          "Такого поля нет",
+		"fix_ask_value":              "Правильное значение?",
+		"poll_ask_question":          "О чём голосуем?",
+		"poll_ask_options":           "Варианты ответа через запятую или каждый с новой строки? Отправьте -, чтобы голосовать «за» и «против»",
+		"poll_options_count":         "Нужно от 2 до %v вариантов",
+
+		"callback_invalid": "Эта кнопка устарела или повреждена",
+
+		"callback_expired": "Этот результат устарел, повторите поиск",
+	},
+	"en": {
+		"no_permission_command": "You are not allowed to use this command",
+		"no_permission_action":  "You are not allowed to do this",
+		"service_unavailable":   "Error. Service is unavailable",
+		"button_ok":             "✅ OK",
+		"button_cancel":         "🚫 Cancel",
+		"lang_usage":            "Usage: /lang [ru|en|zh]. Current language: %v",
+		"lang_set":              "Language switched to English 🇬🇧",
+
+		"card_name_too_short": "The card name should be a bit longer 😔",
+		"card_not_found":      "Sorry, I couldn't find such a card 😢",
+
+		"poll_vote_for":        "👍 For",
+		"poll_vote_against":    "👎 Against",
+		"poll_choose":          "Choose one of the options:",
+		"poll_choose_public":   "Choose one of the options (public poll, everyone will see who voted):",
+		"poll_button_close":    "🔒 Close",
+		"poll_button_voters":   "👥 Who voted",
+		"poll_closed_title":    "<b>The poll is closed</b>",
+		"poll_total":           "Total votes: %v",
+		"poll_no_votes":        "Nobody voted 😔",
+		"poll_tie":             "Result: tie",
+		"poll_winner":          "Winner: <b>%v</b>",
+		"poll_not_reply":       "The command must be a reply to the poll message 😔",
+		"poll_not_poll":        "This message is not a poll 😔",
+		"poll_close_forbidden": "Only the author or an administrator can close the poll",
+		"poll_already_closed":  "The poll is already closed",
+		"poll_closed":          "The poll is closed",
+		"poll_anonymous":       "This poll is anonymous",
+		"poll_results":         "Poll results:",
+		"poll_already_voted":   "You have already voted in this poll",
+		"poll_vote_accepted":   "Thank you, your vote is counted",
+
+		"reminder_saved":     "Done 👌\n%v",
+		"remind_usage":       "Usage: /remind [30m | 18:30 | 31.12 18:30] [text]",
+		"announce_usage":     "Usage: /announce daily 09:00 [text] or /announce weekly sun 20:00 [text]",
+		"reminders_empty":    "There are no reminders in this chat",
+		"reminders_list":     "Reminders:\n%v",
+		"unremind_usage":     "Usage: /unremind [id]",
+		"reminder_not_found": "The reminder is not found or was created by another user",
+		"reminder_deleted":   "The reminder is deleted",
+		"reminder_daily":     "#%v daily at %v — %v",
+		"reminder_weekly":    "#%v weekly (%v) at %v — %v",
+		"reminder_once":      "#%v %v — %v",
+		"weekday_0":          "Sun",
+		"weekday_1":          "Mon",
+		"weekday_2":          "Tue",
+		"weekday_3":          "Wed",
+		"weekday_4":          "Thu",
+		"weekday_5":          "Fri",
+		"weekday_6":          "Sat",
+
+		"report_line":             "<b>#%v</b> %v%v from %v:\n%v",
+		"report_new":              "📝 New problem report\n%v",
+		"report_thanks":           "Thank you! Your report #%v has been passed to the administrators 🙏",
+		"reports_empty":           "There are no open reports 🎉",
+		"resolve_usage":           "Usage: /resolve [id] [comment]",
+		"report_not_found":        "Report #%v is not found",
+		"report_already_resolved": "Report #%v is already resolved",
+		"report_resolved_notice":  "✅ %v, your report #%v is fixed. Thank you for the help!",
+		"report_resolved":         "Report #%v is resolved",
+
+		"templates_reload_failed": "Can't load templates: %v",
+		"templates_reloaded":      "Templates are reloaded 👌",
+		"import_started":          "Card import started...",
+		"import_failed":           "Import failed: %v",
+		"import_finished":         "Import finished: %v cards, %v skills",
+		"stats_title":             "<b>Statistics</b>",
+		"stats_cards":             "Cards",
+		"stats_skills":            "Skills",
+		"stats_polls":             "Polls",
+		"stats_active_polls":      "Active polls",
+		"stats_votes":             "Votes",
+		"stats_reminders":         "Reminders",
+		"stats_open_reports":      "Open reports",
+		"stats_banned":            "Banned users",
+		"ban_usage":               "Usage: /ban [user id] [reason] or a reply to the user's message",
+		"ban_admin":               "Administrators can't be banned",
+		"banned":                  "User %v is banned",
+		"unban_usage":             "Usage: /unban [user id] or a reply to the user's message",
+		"unbanned":                "User %v is unbanned",
+
+		"fix_line":             "<b>Correction #%v</b> for card [id:%v] from %v\n%v: <code>%v</code> → <code>%v</code>",
+		"fix_usage":            "Usage: /fix [card id] [field]=[value]\nFields: %v",
+		"fix_not_number":       "The value of %v must be a number",
+		"fix_no_skill":         "This card has no skill the field %v belongs to",
+		"fix_button_approve":   "✅ Approve",
+		"fix_button_reject":    "🚫 Reject",
+		"fix_sent":             "Thank you! Correction #%v is sent for review 🙏",
+		"fix_already_reviewed": "This correction is already reviewed",
+		"fix_approved":         "✅ Approved",
+		"fix_rejected":         "🚫 Rejected",
+		"fix_approved_notice":  "Your correction #%v for card [id:%v] is approved. Thank you! 🎉",
+		"fix_rejected_notice":  "Your correction #%v for card [id:%v] is rejected 😔",
+
+		"compare_usage":          "Usage: /compare [id] [id] [id], 2 or 3 cards can be compared",
+		"compare_card_not_found": "Card [id:%v] is not found 😢",
+
+		"team_usage":              "Usage: /team [leader] [id] [id] [id] [id] [friend]\nSave: /team save [name] [6 ids]\nShow a saved team: /team [name]\nDelete: /team delete [name]",
+		"team_card_not_found":     "Card [id:%v] is not found 😢",
+		"team_saved":              "Team «%v» is saved",
+		"team_deleted":            "Team «%v» is deleted",
+		"team_not_found":          "Team is not found. Your teams: /teams",
+		"teams_title":             "<b>Your teams:</b>",
+		"teams_empty":             "You have no saved teams. Save one: /team save [name] [6 ids]",
+		"team_button_share":       "📤 Share",
+		"team_inline_description": "Cards: %v",
+
+		"dmg_usage": "Usage: /dmg [leader] [id] [id] [id] [id] [friend] or /dmg [name of a saved team]",
+
+		"own_usage":   "Usage: /own add [id] [id]... or /own remove [id] [id]...",
+		"own_added":   "Cards added to your box: %v",
+		"own_removed": "Cards removed from your box: %v",
+		"own_unknown": "Cards not found: %v",
+		"box_empty":   "Your box is empty. Add cards: /own add [id] [id]...",
+		"box_title":   "<b>Your box, %v cards</b>",
+		"box_more":    "...and %v more",
+
+		"group_only":          "This command works in group chats only",
+		"whohas_usage":        "Usage: /whohas [card id or name]",
+		"whohas_title":        "%v is owned by:",
+		"whohas_nobody":       "Nobody in this chat owns %v. Cards are added with /own add",
+		"roster_empty":        "Nobody in this chat has added cards to their box yet. Command: /own add [id] [id]...",
+		"roster_title":        "<b>Chat collection</b>: %v members, %v different cards",
+		"roster_by_attribute": "By attribute",
+		"roster_by_race":      "By race",
+
+		"import_stages_finished": "Stages loaded: %v, enemies: %v",
+		"stage_usage":            "Usage: /stage [stage name]",
+		"stage_not_found":        "Stage is not found 😢 Stage data is loaded with /import",
+
+		"counter_usage": "Usage: /counter [stage name], add own at the end to pick only cards from your box",
+
+		"conversation_hint":          "<i>/back — return to the previous question, /cancel — cancel</i>",
+		"conversation_cancelled":     "Cancelled",
+		"conversation_none":          "There is nothing to cancel",
+		"conversation_empty_answer":  "The answer can't be empty",
+		"conversation_ids_count":     "Number of cards expected: %v",
+		"conversation_ids_not_found": "Cards not found: %v",
+		"team_ask_leader":            "Id of the leader card?",
+		"team_ask_members":           "Ids of 4 team cards separated by spaces?",
+		"team_ask_friend":            "Id of the friend's card?",
+		"team_ask_name":              "Name to save the team with? Send - to not save it",
+		"fix_ask_card":               "Id of the card to correct?",
+		"fix_ask_field":              "Which field should be corrected?\nFields: %v",
+		"fix_unknown_field":          "There is no such field",
+		"fix_ask_value":              "The correct value?",
+		"poll_ask_question":          "What is the poll about?",
+		"poll_ask_options":           "Options separated by commas or each on a new line? Send - to vote for and against",
+		"poll_options_count":         "From 2 to %v options are needed",
+
+		"callback_invalid": "This button is outdated or damaged",
+
+		"callback_expired": "This result has expired, please search again",
+	},
+	"zh": {
+		"no_permission_command": "您无权使用此命令",
+		"no_permission_action":  "您无权执行此操作",
+		"service_unavailable":   "错误，服务不可用",
+		"button_ok":             "✅ 确定",
+		"button_cancel":         "🚫 取消",
+		"lang_usage":            "格式：/lang [ru|en|zh]。当前语言：%v",
+		"lang_set":              "语言已切换为中文 🇨🇳",
+
+		"card_name_too_short": "卡牌名称需要再长一点 😔",
+		"card_not_found":      "抱歉，找不到这张卡牌 😢",
+
+		"poll_vote_for":        "👍 赞成",
+		"poll_vote_against":    "👎 反对",
+		"poll_choose":          "请选择一个选项：",
+		"poll_choose_public":   "请选择一个选项（公开投票，所有人都能看到投票者）：",
+		"poll_button_close":    "🔒 结束",
+		"poll_button_voters":   "👥 投票者",
+		"poll_closed_title":    "<b>投票已结束</b>",
+		"poll_total":           "总票数：%v",
+		"poll_no_votes":        "没有人投票 😔",
+		"poll_tie":             "结果：平局",
+		"poll_winner":          "胜出选项：<b>%v</b>",
+		"poll_not_reply":       "此命令需要回复投票消息 😔",
+		"poll_not_poll":        "这条消息不是投票 😔",
+		"poll_close_forbidden": "只有发起人或管理员可以结束投票",
+		"poll_already_closed":  "投票已经结束",
+		"poll_closed":          "投票已结束",
+		"poll_anonymous":       "这是匿名投票",
+		"poll_results":         "投票结果：",
+		"poll_already_voted":   "您已经投过票了",
+		"poll_vote_accepted":   "谢谢，您的投票已记录",
+
+		"reminder_saved":     "完成 👌\n%v",
+		"remind_usage":       "格式：/remind [30m | 18:30 | 31.12 18:30] [内容]",
+		"announce_usage":     "格式：/announce daily 09:00 [内容] 或 /announce weekly sun 20:00 [内容]",
+		"reminders_empty":    "此聊天没有提醒",
+		"reminders_list":     "提醒：\n%v",
+		"unremind_usage":     "格式：/unremind [id]",
+		"reminder_not_found": "未找到提醒，或该提醒由其他用户创建",
+		"reminder_deleted":   "提醒已删除",
+		"reminder_daily":     "#%v 每天 %v — %v",
+		"reminder_weekly":    "#%v 每周（%v）%v — %v",
+		"reminder_once":      "#%v %v — %v",
+		"weekday_0":          "周日",
+		"weekday_1":          "周一",
+		"weekday_2":          "周二",
+		"weekday_3":          "周三",
+		"weekday_4":          "周四",
+		"weekday_5":          "周五",
+		"weekday_6":          "周六",
+
+		"report_line":             "<b>#%v</b> %v%v 来自 %v：\n%v",
+		"report_new":              "📝 新的错误报告\n%v",
+		"report_thanks":           "谢谢！您的报告 #%v 已转交管理员 🙏",
+		"reports_empty":           "没有未处理的报告 🎉",
+		"resolve_usage":           "格式：/resolve [id] [备注]",
+		"report_not_found":        "未找到报告 #%v",
+		"report_already_resolved": "报告 #%v 已经处理",
+		"report_resolved_notice":  "✅ %v，您的报告 #%v 已修复。感谢您的帮助！",
+		"report_resolved":         "报告 #%v 已处理",
+
+		"templates_reload_failed": "无法加载模板：%v",
+		"templates_reloaded":      "模板已重新加载 👌",
+		"import_started":          "开始导入卡牌...",
+		"import_failed":           "导入失败：%v",
+		"import_finished":         "导入完成：%v 张卡牌，%v 个技能",
+		"stats_title":             "<b>统计</b>",
+		"stats_cards":             "卡牌",
+		"stats_skills":            "技能",
+		"stats_polls":             "投票",
+		"stats_active_polls":      "进行中的投票",
+		"stats_votes":             "票数",
+		"stats_reminders":         "提醒",
+		"stats_open_reports":      "未处理的报告",
+		"stats_banned":            "被封禁的用户",
+		"ban_usage":               "格式：/ban [user id] [原因] 或回复该用户的消息",
+		"ban_admin":               "不能封禁管理员",
+		"banned":                  "用户 %v 已被封禁",
+		"unban_usage":             "格式：/unban [user id] 或回复该用户的消息",
+		"unbanned":                "用户 %v 已解除封禁",
+
+		"fix_line":             "<b>修正 #%v</b> 卡牌 [id:%v] 来自 %v\n%v：<code>%v</code> → <code>%v</code>",
+		"fix_usage":            "格式：/fix [卡牌 id] [字段]=[值]\n字段：%v",
+		"fix_not_number":       "字段 %v 的值必须是数字",
+		"fix_no_skill":         "这张卡牌没有字段 %v 所属的技能",
+		"fix_button_approve":   "✅ 通过",
+		"fix_button_reject":    "🚫 拒绝",
+		"fix_sent":             "谢谢！修正 #%v 已提交审核 🙏",
+		"fix_already_reviewed": "此修正已经审核过了",
+		"fix_approved":         "✅ 已通过",
+		"fix_rejected":         "🚫 已拒绝",
+		"fix_approved_notice":  "您对卡牌 [id:%[2]v] 的修正 #%[1]v 已通过。谢谢！🎉",
+		"fix_rejected_notice":  "您对卡牌 [id:%[2]v] 的修正 #%[1]v 被拒绝 😔",
+
+		"compare_usage":          "格式：/compare [id] [id] [id]，可以比较 2 或 3 张卡牌",
+		"compare_card_not_found": "找不到卡牌 [id:%v] 😢",
+
+		"team_usage":              "格式：/team [队长] [id] [id] [id] [id] [战友]\n保存：/team save [名称] [6 个 id]\n查看已保存的队伍：/team [名称]\n删除：/team delete [名称]",
+		"team_card_not_found":     "找不到卡牌 [id:%v] 😢",
+		"team_saved":              "队伍「%v」已保存",
+		"team_deleted":            "队伍「%v」已删除",
+		"team_not_found":          "找不到该队伍。您的队伍：/teams",
+		"teams_title":             "<b>您的队伍：</b>",
+		"teams_empty":             "您还没有保存的队伍。保存：/team save [名称] [6 个 id]",
+		"team_button_share":       "📤 分享",
+		"team_inline_description": "卡牌：%v",
+
+		"dmg_usage": "格式：/dmg [队长] [id] [id] [id] [id] [战友] 或 /dmg [已保存的队伍名称]",
+
+		"own_usage":   "格式：/own add [id] [id]... 或 /own remove [id] [id]...",
+		"own_added":   "已加入背包的卡牌：%v",
+		"own_removed": "已从背包移除的卡牌：%v",
+		"own_unknown": "找不到卡牌：%v",
+		"box_empty":   "您的背包是空的。加入卡牌：/own add [id] [id]...",
+		"box_title":   "<b>您的背包，共 %v 张卡牌</b>",
+		"box_more":    "……还有 %v 张",
+
+		"group_only":          "此命令仅在群组中可用",
+		"whohas_usage":        "格式：/whohas [卡牌 id 或名称]",
+		"whohas_title":        "拥有 %v 的成员：",
+		"whohas_nobody":       "本群中没有人拥有 %v。使用 /own add 加入卡牌",
+		"roster_empty":        "本群中还没有人将卡牌加入背包。命令：/own add [id] [id]...",
+		"roster_title":        "<b>群组收藏</b>：%v 位成员，%v 种不同的卡牌",
+		"roster_by_attribute": "按属性",
+		"roster_by_race":      "按种族",
+
+		"import_stages_finished": "已载入关卡：%v，敌人：%v",
+		"stage_usage":            "格式：/stage [关卡名称]",
+		"stage_not_found":        "找不到该关卡 😢 关卡数据通过 /import 载入",
+
+		"counter_usage": "格式：/counter [关卡名称]，在末尾加上 own 则只从您背包的卡牌中挑选",
+
+		"conversation_hint":          "<i>/back — 返回上一个问题，/cancel — 取消</i>",
+		"conversation_cancelled":     "已取消",
+		"conversation_none":          "当前没有可以取消的操作",
+		"conversation_empty_answer":  "回答不能为空",
+		"conversation_ids_count":     "需要的卡牌数量：%v",
+		"conversation_ids_not_found": "找不到卡牌：%v",
+		"team_ask_leader":            "队长卡牌的 id？",
+		"team_ask_members":           "4 张队员卡牌的 id，用空格分隔？",
+		"team_ask_friend":            "战友卡牌的 id？",
+		"team_ask_name":              "保存队伍的名称？发送 - 则不保存",
+		"fix_ask_card":               "需要修正的卡牌 id？",
+		"fix_ask_field":              "需要修正哪个字段？\n字段：%v",
+		"fix_unknown_field":          "没有这个字段",
+		"fix_ask_value":              "正确的值是？",
+		"poll_ask_question":          "投票的主题是什么？",
+		"poll_ask_options":           "选项用逗号分隔或每行一个？发送 - 则使用「赞成」和「反对」",
+		"poll_options_count":         "需要 2 到 %v 个选项",
+
+		"callback_invalid": "此按钮已过期或无效",
+
+		"callback_expired": "此结果已过期，请重新搜索",
+	},
+}
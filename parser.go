@@ -112,6 +112,10 @@ func (card *Card) Parse(doc *goquery.Document) error {
 			card.TotalStats = SumStats(ReplaceWSpace(s.Text()))
 		case 25:
 			skill_name := ReplaceRN(CARD_ATTRIBUTE_REGEX.ReplaceAllString(s.Text(), ""))
+			if strings.TrimSpace(skill_name) == "" {
+				// the card has no such skill, it stays nil
+				return
+			}
 			skillMap.mx.Lock()
 			skill, exists := skillMap.value[skill_name]
 			if !exists {
@@ -124,15 +128,28 @@ func (card *Card) Parse(doc *goquery.Document) error {
 			}
 			skillMap.mx.Unlock()
 		case 26:
+			if card.ActiveSkill == nil {
+				return
+			}
 			skill_cd, _ := strconv.Atoi(ReplaceWSpace(s.Text()))
 			card.ActiveSkill.Lv1CD = skill_cd
 		case 27:
+			if card.ActiveSkill == nil {
+				return
+			}
 			skill_cd, _ := strconv.Atoi(ReplaceWSpace(s.Text()))
 			card.ActiveSkill.LvMaxCD = skill_cd
 		case 28:
+			if card.ActiveSkill == nil {
+				return
+			}
 			card.ActiveSkill.Effect = ReplaceRN(CARD_ATTRIBUTE_REGEX.ReplaceAllString(s.Text(), ""))
 		case 30:
 			skill_name := ReplaceRN(CARD_ATTRIBUTE_REGEX.ReplaceAllString(s.Text(), ""))
+			if strings.TrimSpace(skill_name) == "" {
+				// the card has no such skill, it stays nil
+				return
+			}
 			skillMap.mx.Lock()
 			skill, exists := skillMap.value[skill_name]
 			if !exists {
@@ -145,6 +162,9 @@ func (card *Card) Parse(doc *goquery.Document) error {
 			}
 			skillMap.mx.Unlock()
 		case 31:
+			if card.LeaderSkill == nil {
+				return
+			}
 			card.LeaderSkill.Effect = ReplaceRN(CARD_ATTRIBUTE_REGEX.ReplaceAllString(s.Text(), ""))
 		}
 
@@ -180,10 +200,18 @@ func GetCardHeaders() []string {
 }
 
 func (card *Card) GetRow() []string {
-	arr := []string{card.Id, card.Name, card.Attribute, strconv.Itoa(card.Rarity), strconv.Itoa(card.Cost), card.Race, card.Series, strconv.Itoa(card.MaxExp), strconv.Itoa(card.M_Hp), strconv.Itoa(card.M_Att), strconv.Itoa(card.M_Rec), strconv.Itoa(card.TotalStats), card.WikiLink, card.PreviewLink, card.ActiveSkill.Id, card.LeaderSkill.Id}
+	arr := []string{card.Id, card.Name, card.Attribute, strconv.Itoa(card.Rarity), strconv.Itoa(card.Cost), card.Race, card.Series, strconv.Itoa(card.MaxExp), strconv.Itoa(card.M_Hp), strconv.Itoa(card.M_Att), strconv.Itoa(card.M_Rec), strconv.Itoa(card.TotalStats), card.WikiLink, card.PreviewLink, skillId(card.ActiveSkill), skillId(card.LeaderSkill)}
 	return arr
 }
 
+// skillId returns an empty id for a missing skill
+func skillId(skill *Skill) string {
+	if skill == nil {
+		return ""
+	}
+	return skill.Id
+}
+
 func ReplaceWSpace(s string) string {
 	return strings.Map(func(r rune) rune {
 		if unicode.IsSpace(r) {
@@ -238,6 +266,145 @@ func parseUrl(url string) []string {
 	return result
 }
 
+// StageEnemy is an enemy on a floor of a stage, written to parsed_stages.csv
+type StageEnemy struct {
+	Stage     string
+	StageLink string
+	Floor     int
+	Name      string
+	Attribute string
+	Hp        int
+	Attack    int
+	Cd        int
+	Abilities string
+	Link      string
+}
+
+const STAGE_LIST_URL = "http://towerofsaviors.wikia.com/wiki/Stages"
+
+func (enemy *StageEnemy) GetRow() []string {
+	return []string{enemy.Stage, enemy.StageLink, strconv.Itoa(enemy.Floor), enemy.Name, enemy.Attribute, strconv.Itoa(enemy.Hp), strconv.Itoa(enemy.Attack), strconv.Itoa(enemy.Cd), enemy.Abilities, enemy.Link}
+}
+
+// ParseNumber reads numbers like "1,234,567", other characters are skipped
+func ParseNumber(s string) int {
+	v, _ := strconv.Atoi(strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s))
+	return v
+}
+
+// parseStageList returns links of stage pages found in the tables of the list page
+func parseStageList(url string) []string {
+	result := make([]string, 0, 50)
+	seen := make(map[string]bool)
+	doc, err := goquery.NewDocument(url)
+	_check(err)
+	doc.Find("#mw-content-text table a[href^='/wiki/']").Each(func(i int, s *goquery.Selection) {
+		attr, _ := s.Attr("href")
+		if strings.Contains(attr, ":") || seen[attr] {
+			return
+		}
+		seen[attr] = true
+		result = append(result, fmt.Sprintf("http://towerofsaviors.wikia.com%v", attr))
+	})
+	return result
+}
+
+// parseStage reads enemies of every floor. Every table with an HP column is a floor,
+// columns are found by their headers, so the order of columns doesn`t matter.
+func parseStage(url string) []StageEnemy {
+	enemies := make([]StageEnemy, 0, 20)
+	doc, err := goquery.NewDocument(url)
+	_check(err)
+	stage := ReplaceRN(strings.TrimSpace(doc.Find("h1").First().Text()))
+	floor := 0
+	doc.Find("#mw-content-text table").Each(func(i int, table *goquery.Selection) {
+		columns := make(map[string]int)
+		table.Find("tr").First().Find("th").Each(func(j int, th *goquery.Selection) {
+			header := strings.ToLower(th.Text())
+			switch {
+			case strings.Contains(header, "hp"):
+				columns["hp"] = j
+			case strings.Contains(header, "atk") || strings.Contains(header, "attack"):
+				columns["attack"] = j
+			case strings.Contains(header, "cd"):
+				columns["cd"] = j
+			case strings.Contains(header, "attribute"):
+				columns["attribute"] = j
+			case strings.Contains(header, "abilit") || strings.Contains(header, "skill"):
+				columns["abilities"] = j
+			case strings.Contains(header, "name") || strings.Contains(header, "enemy"):
+				columns["name"] = j
+			}
+		})
+		if _, ok := columns["hp"]; !ok {
+			return
+		}
+		floor++
+		table.Find("tr").Each(func(j int, tr *goquery.Selection) {
+			cells := tr.Find("td")
+			if cells.Length() == 0 {
+				return
+			}
+			cell := func(name string) *goquery.Selection {
+				idx, ok := columns[name]
+				if !ok {
+					return &goquery.Selection{}
+				}
+				return cells.Eq(idx)
+			}
+			enemy := StageEnemy{Stage: stage, StageLink: url, Floor: floor}
+			enemy.Name = strings.TrimSpace(ReplaceRN(cell("name").Text()))
+			enemy.Attribute = ReplaceWSpace(cell("attribute").Text())
+			if enemy.Attribute == "" {
+				// attributes are often shown as icons
+				enemy.Attribute, _ = cell("attribute").Find("img").Attr("alt")
+				enemy.Attribute = strings.TrimSuffix(enemy.Attribute, ".png")
+			}
+			enemy.Hp = ParseNumber(cell("hp").Text())
+			enemy.Attack = ParseNumber(cell("attack").Text())
+			enemy.Cd = ParseNumber(cell("cd").Text())
+			enemy.Abilities = strings.TrimSpace(ReplaceRN(cell("abilities").Text()))
+			if href, ok := tr.Find("a[href^='/wiki/']").First().Attr("href"); ok {
+				enemy.Link = fmt.Sprintf("http://towerofsaviors.wikia.com%v", href)
+			}
+			if enemy.Name == "" && enemy.Hp == 0 {
+				return
+			}
+			enemies = append(enemies, enemy)
+		})
+	})
+	return enemies
+}
+
+// parseStages writes enemies of all stages from the list page into parsed_stages.csv
+func parseStages(listUrl string) {
+	out, err := os.Create("parsed_stages.csv")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer out.Close()
+	w := csv.NewWriter(out)
+	w.Comma = '$'
+	counter := 0
+	log.Printf("--------Stages parse process started-------\n")
+	for _, url := range parseStageList(listUrl) {
+		fmt.Println("Processing : ", url)
+		for _, enemy := range parseStage(url) {
+			w.Write(enemy.GetRow())
+			counter++
+		}
+		time.Sleep(time.Second)
+	}
+	w.Flush()
+	log.Printf("--------Stages parse FINISHED. Total %v rows written\n", counter)
+}
+
 func main() {
 	// doc, _ := goquery.NewDocument("http://towerofsaviors.wikia.com/wiki/Poker_King_-_Paxton")
 	// card := NewCard()
@@ -252,6 +419,16 @@ func main() {
 	defer f.Close()
 	log.SetOutput(f)
 
+	// "parser stages [list url]" crawls stages instead of cards
+	if len(os.Args) > 1 && os.Args[1] == "stages" {
+		listUrl := STAGE_LIST_URL
+		if len(os.Args) > 2 {
+			listUrl = os.Args[2]
+		}
+		parseStages(listUrl)
+		return
+	}
+
 	out, oerr := os.Create("parsed.csv")
 	if oerr != nil {
 		fmt.Println(oerr)
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// minimal pause between two edits of the same poll message,
+// keeps busy polls below telegram edit limits
+const POLL_EDIT_INTERVAL = 3 * time.Second
+
+// a poll whose results can't be shown is closed again after the interval,
+// after POLL_CLOSE_ATTEMPTS failures it is marked closed without the results
+const POLL_CLOSE_RETRY_INTERVAL = time.Minute
+const POLL_CLOSE_ATTEMPTS = 5
+
+const (
+	POLL_EVENT_CREATED = iota
+	POLL_EVENT_VOTED
+	POLL_EVENT_CLOSED
+)
+
+// pollEdits serializes edits of poll messages by handlers and the watcher,
+// so a refresh of the keyboard can't overwrite the final results
+var pollEdits sync.Mutex
+
+type pollEvent struct {
+	Type   int
+	PollId int
+	Poll   *Poll
+}
+
+type watchedPoll struct {
+	poll      *Poll
+	dirty     bool
+	scheduled bool
+	lastEdit  time.Time
+	retryAt   time.Time
+	expire    *time.Timer
+	attempts  int
+}
+
+type pollWatcher struct {
+	api     Sender
+	command Command
+	polls   map[int]*watchedPoll
+	flush   chan int
+	expired chan int
+}
+
+// watchActivePolls keeps poll messages in sync with votes.
+// Handlers report changes through events, edits of each poll are debounced
+// and postponed when telegram asks to retry later.
+func watchActivePolls(api Sender, events chan pollEvent) {
+	watcher := pollWatcher{
+		api:     api,
+		command: Command{commWord: "poll"},
+		polls:   make(map[int]*watchedPoll),
+		flush:   make(chan int, 100),
+		expired: make(chan int, 100),
+	}
+	polls, err := pollStore.ActivePolls()
+	if err != nil {
+		log.Printf("[Error] Can`t load active polls: %v", err)
+	}
+	for _, poll := range polls {
+		// votes could come in while the bot was down, so refresh every loaded poll once
+		watcher.watch(poll, true)
+	}
+	for {
+		select {
+		case event := <-events:
+			watcher.handleEvent(event)
+		case pollId := <-watcher.flush:
+			watcher.refresh(pollId)
+		case pollId := <-watcher.expired:
+			watcher.close(pollId)
+		}
+	}
+}
+
+func (watcher *pollWatcher) watch(poll *Poll, dirty bool) {
+	item := &watchedPoll{poll: poll}
+	watcher.polls[poll.Id] = item
+	item.expire = time.AfterFunc(time.Until(poll.ActiveUntil), func() {
+		watcher.expired <- poll.Id
+	})
+	if dirty {
+		item.dirty = true
+		watcher.schedule(item)
+	}
+}
+
+func (watcher *pollWatcher) handleEvent(event pollEvent) {
+	switch event.Type {
+	case POLL_EVENT_CREATED:
+		watcher.watch(event.Poll, false)
+	case POLL_EVENT_VOTED:
+		item, ok := watcher.polls[event.PollId]
+		if !ok {
+			return
+		}
+		item.dirty = true
+		watcher.schedule(item)
+	case POLL_EVENT_CLOSED:
+		item, ok := watcher.polls[event.PollId]
+		if !ok {
+			return
+		}
+		item.expire.Stop()
+		delete(watcher.polls, event.PollId)
+	}
+}
+
+// schedule plans a single edit of the poll message not earlier than
+// POLL_EDIT_INTERVAL after the previous one
+func (watcher *pollWatcher) schedule(item *watchedPoll) {
+	if item.scheduled {
+		return
+	}
+	at := item.lastEdit.Add(POLL_EDIT_INTERVAL)
+	if item.retryAt.After(at) {
+		at = item.retryAt
+	}
+	pollId := item.poll.Id
+	item.scheduled = true
+	time.AfterFunc(time.Until(at), func() {
+		watcher.flush <- pollId
+	})
+}
+
+func (watcher *pollWatcher) refresh(pollId int) {
+	item, ok := watcher.polls[pollId]
+	if !ok {
+		return
+	}
+	item.scheduled = false
+	if !item.dirty {
+		return
+	}
+	item.dirty = false
+	votes, err := voteStore.PollVotes(pollId)
+	if err != nil {
+		log.Printf("[Error] Can`t load votes of poll %v: %v", pollId, err)
+		return
+	}
+	pollEdits.Lock()
+	defer pollEdits.Unlock()
+	// the poll could be closed by a handler since the refresh was planned
+	poll, perr := pollStore.PollById(pollId)
+	if perr != nil {
+		log.Printf("[Error] Can`t load poll %v: %v", pollId, perr)
+		return
+	}
+	if poll.Closed {
+		item.expire.Stop()
+		delete(watcher.polls, pollId)
+		return
+	}
+	markup, kerr := watcher.command.pollKeyboard(item.poll, votes)
+	if kerr != nil {
+		log.Printf("[Error] Can`t build keyboard of poll %v: %v", pollId, kerr)
+		return
+	}
+	msg := tgbotapi.NewEditMessageReplyMarkup(item.poll.ChatId, item.poll.MessageId, markup)
+	_, serr := watcher.api.Send(msg)
+	item.lastEdit = time.Now()
+	if tgErr, ok := serr.(tgbotapi.Error); ok && tgErr.RetryAfter > 0 {
+		item.retryAt = time.Now().Add(time.Duration(tgErr.RetryAfter) * time.Second)
+		item.dirty = true
+		watcher.schedule(item)
+	} else if serr != nil && !strings.Contains(serr.Error(), "message is not modified") {
+		log.Printf("[Error] Can`t update poll %v: %v", pollId, serr)
+	}
+}
+
+func (watcher *pollWatcher) close(pollId int) {
+	item, ok := watcher.polls[pollId]
+	if !ok {
+		return
+	}
+	err := watcher.command.closePoll(watcher.api, item.poll)
+	if err == nil {
+		delete(watcher.polls, pollId)
+		return
+	}
+	item.attempts++
+	log.Printf("[Error] Can`t close poll %v, attempt %v: %v", pollId, item.attempts, err)
+	if item.attempts >= POLL_CLOSE_ATTEMPTS {
+		delete(watcher.polls, pollId)
+		_, cerr := pollStore.ClosePoll(item.poll)
+		if cerr != nil {
+			log.Printf("[Error] Can`t mark poll %v closed: %v", pollId, cerr)
+		}
+		return
+	}
+	wait := POLL_CLOSE_RETRY_INTERVAL
+	if tgErr, ok := err.(tgbotapi.Error); ok && tgErr.RetryAfter > 0 {
+		wait = time.Duration(tgErr.RetryAfter) * time.Second
+	}
+	item.expire = time.AfterFunc(wait, func() {
+		watcher.expired <- pollId
+	})
+}
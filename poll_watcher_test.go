@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// testPoll creates a poll about a message through /poll and returns it with its options
+func testPoll(t *testing.T, store *memoryStore, api *fakeSender) (*Poll, []Vote) {
+	t.Helper()
+	message := testMessage(TEST_GROUP_ID, TEST_USER_ID, "/poll")
+	message.ReplyToMessage = &tgbotapi.Message{MessageID: 5}
+	if err := runMessage(api, message); err != nil {
+		t.Fatal(err)
+	}
+	poll, err := store.PollByMessage(TEST_GROUP_ID, api.lastId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	votes, _ := store.PollVotes(poll.Id)
+	return poll, votes
+}
+
+func newTestWatcher(api Sender) *pollWatcher {
+	return &pollWatcher{
+		api:     api,
+		command: Command{commWord: "poll"},
+		polls:   make(map[int]*watchedPoll),
+		flush:   make(chan int, 100),
+		expired: make(chan int, 100),
+	}
+}
+
+func countEdits(api *fakeSender) (markups int, texts int) {
+	for _, c := range api.sent {
+		switch c.(type) {
+		case tgbotapi.EditMessageReplyMarkupConfig:
+			markups++
+		case tgbotapi.EditMessageTextConfig:
+			texts++
+		}
+	}
+	return
+}
+
+func TestPollWatcherRefreshAfterClose(t *testing.T) {
+	store := useMemoryStore(t)
+	api := &fakeSender{}
+	poll, votes := testPoll(t, store, api)
+	watcher := newTestWatcher(api)
+	watcher.watch(poll, false)
+	defer watcher.polls[poll.Id].expire.Stop()
+
+	store.RecordVote(&PollUser{PollId: poll.Id, UserId: TEST_OTHER_USER_ID, VoteId: votes[0].Id})
+	watcher.handleEvent(pollEvent{Type: POLL_EVENT_VOTED, PollId: poll.Id})
+	watcher.refresh(poll.Id)
+	if markups, _ := countEdits(api); markups != 1 {
+		t.Fatalf("%v keyboard edits after a vote, want 1", markups)
+	}
+
+	// a refresh planned before the poll was closed by its author must not bring the keyboard back
+	store.RecordVote(&PollUser{PollId: poll.Id, UserId: TEST_USER_ID, VoteId: votes[1].Id})
+	watcher.handleEvent(pollEvent{Type: POLL_EVENT_VOTED, PollId: poll.Id})
+	closed, _ := store.PollById(poll.Id)
+	if err := (&Command{commWord: "poll"}).closePoll(api, closed); err != nil {
+		t.Fatal(err)
+	}
+	watcher.refresh(poll.Id)
+	markups, texts := countEdits(api)
+	if markups != 1 || texts != 1 {
+		t.Errorf("%v keyboard edits and %v result edits, want the results to stay", markups, texts)
+	}
+	if _, ok := watcher.polls[poll.Id]; ok {
+		t.Error("the closed poll is still watched")
+	}
+}
+
+func TestVoteWithBusyWatcher(t *testing.T) {
+	store := useMemoryStore(t)
+	api := &fakeSender{}
+	poll, votes := testPoll(t, store, api)
+	for len(pollEvents) < cap(pollEvents) {
+		pollEvents <- pollEvent{Type: POLL_EVENT_VOTED, PollId: poll.Id}
+	}
+	data, _ := encodeCallback("poll", strconv.Itoa(poll.Id), strconv.Itoa(votes[0].Id))
+	done := make(chan error)
+	go func() {
+		done <- runCallback(api, TEST_GROUP_ID, poll.MessageId, TEST_USER_ID, data)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the vote waits for the poll watcher")
+	}
+	if text := api.lastAnswer(t); text != tr(DEFAULT_LANGUAGE, "poll_vote_accepted") {
+		t.Errorf("answer to the vote = %q", text)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const REMINDER_REPEAT_NONE = 0
+const REMINDER_REPEAT_DAILY = 1
+const REMINDER_REPEAT_WEEKLY = 2
+
+// how long the scheduler sleeps when there is nothing to fire
+const REMINDER_IDLE_WAIT = time.Hour
+
+// reminders which could not be sent stay due and are sent again after the interval
+const REMINDER_RETRY_INTERVAL = time.Minute
+
+var reminderLocation = loadReminderLocation()
+
+var reminderWakeup = make(chan struct{}, 1)
+
+var clockRegex = regexp.MustCompile(`^([01]?\d|2[0-3]):([0-5]\d)$`)
+var dateRegex = regexp.MustCompile(`^(0?[1-9]|[12]\d|3[01])\.(0?[1-9]|1[0-2])$`)
+
+var weekdayNames = map[string]time.Weekday{
+	"mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday, "thu": time.Thursday,
+	"fri": time.Friday, "sat": time.Saturday, "sun": time.Sunday,
+	"пн": time.Monday, "вт": time.Tuesday, "ср": time.Wednesday, "чт": time.Thursday,
+	"пт": time.Friday, "сб": time.Saturday, "вс": time.Sunday,
+	"周一": time.Monday, "周二": time.Tuesday, "周三": time.Wednesday, "周四": time.Thursday,
+	"周五": time.Friday, "周六": time.Saturday, "周日": time.Sunday,
+}
+
+type Reminder struct {
+	Id      int
+	ChatId  int64
+	UserId  int
+	Text    string
+	FireAt  time.Time
+	Repeat  int
+	Created time.Time
+}
+
+func loadReminderLocation() *time.Location {
+	name := config.Section("bot").Key("timezone").MustString("Local")
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("[Error] Unknown timezone %q, falling back to local time: %v", name, err)
+		return time.Local
+	}
+	return location
+}
+
+// wakeReminders makes the scheduler re-read the reminders table
+func wakeReminders() {
+	select {
+	case reminderWakeup <- struct{}{}:
+	default:
+	}
+}
+
+// nextFire returns the first occurrence of a recurring reminder after now
+func (reminder *Reminder) nextFire(now time.Time) time.Time {
+	days := 1
+	if reminder.Repeat == REMINDER_REPEAT_WEEKLY {
+		days = 7
+	}
+	next := reminder.FireAt.In(reminderLocation)
+	for !next.After(now) {
+		next = next.AddDate(0, 0, days)
+	}
+	return next
+}
+
+func (reminder *Reminder) Format(lang string) string {
+	when := reminder.FireAt.In(reminderLocation)
+	text := html.EscapeString(reminder.Text)
+	switch reminder.Repeat {
+	case REMINDER_REPEAT_DAILY:
+		return tr(lang, "reminder_daily", reminder.Id, when.Format("15:04"), text)
+	case REMINDER_REPEAT_WEEKLY:
+		weekday := tr(lang, fmt.Sprintf("weekday_%d", when.Weekday()))
+		return tr(lang, "reminder_weekly", reminder.Id, weekday, when.Format("15:04"), text)
+	default:
+		return tr(lang, "reminder_once", reminder.Id, when.Format("02.01 15:04"), text)
+	}
+}
+
+// parseClock returns the nearest moment after now with the given HH:MM time
+func parseClock(s string, now time.Time) (time.Time, bool) {
+	matches := clockRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return time.Time{}, false
+	}
+	hour, _ := strconv.Atoi(matches[1])
+	minute, _ := strconv.Atoi(matches[2])
+	at := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, reminderLocation)
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, true
+}
+
+// parseRemindTime understands "30m", "2h15m", "18:30" and "31.12 18:30".
+// It returns the fire time and the number of consumed words.
+func parseRemindTime(words []string, now time.Time) (time.Time, int, bool) {
+	if len(words) == 0 {
+		return time.Time{}, 0, false
+	}
+	if duration, err := time.ParseDuration(words[0]); err == nil && duration > 0 {
+		return now.Add(duration), 1, true
+	}
+	if at, ok := parseClock(words[0], now); ok {
+		return at, 1, true
+	}
+	date := dateRegex.FindStringSubmatch(words[0])
+	if date == nil || len(words) < 2 {
+		return time.Time{}, 0, false
+	}
+	clock := clockRegex.FindStringSubmatch(words[1])
+	if clock == nil {
+		return time.Time{}, 0, false
+	}
+	day, _ := strconv.Atoi(date[1])
+	month, _ := strconv.Atoi(date[2])
+	hour, _ := strconv.Atoi(clock[1])
+	minute, _ := strconv.Atoi(clock[2])
+	at := time.Date(now.Year(), time.Month(month), day, hour, minute, 0, 0, reminderLocation)
+	if !at.After(now) {
+		at = time.Date(now.Year()+1, time.Month(month), day, hour, minute, 0, 0, reminderLocation)
+	}
+	// time.Date moves days like 31.02 into the next month
+	if at.Day() != day || at.Month() != time.Month(month) {
+		return time.Time{}, 0, false
+	}
+	return at, 2, true
+}
+
+func (command *Command) saveReminder(api Sender, reminder *Reminder) error {
+	reminder.ChatId = command.tgRequest.Message.Chat.ID
+	reminder.UserId = command.tgRequest.Message.From.ID
+	reminder.Created = time.Now()
+	err := session.Insert(reminder)
+	if err != nil {
+		return err
+	}
+	wakeReminders()
+	return send(api, command.NewMessage(command.tr("reminder_saved", reminder.Format(command.lang()))))
+}
+
+func (command *Command) Remind(api Sender, params string) error {
+	words := strings.Fields(params)
+	at, consumed, ok := parseRemindTime(words, time.Now().In(reminderLocation))
+	if !ok || len(words) == consumed {
+		return send(api, command.NewMessage(command.tr("remind_usage")))
+	}
+	reminder := Reminder{
+		Text:   strings.Join(words[consumed:], " "),
+		FireAt: at,
+		Repeat: REMINDER_REPEAT_NONE,
+	}
+	return command.saveReminder(api, &reminder)
+}
+
+func (command *Command) Announce(api Sender, params string) error {
+	usage := command.tr("announce_usage")
+	words := strings.Fields(params)
+	now := time.Now().In(reminderLocation)
+	reminder := Reminder{}
+	switch {
+	case len(words) >= 3 && words[0] == "daily":
+		at, ok := parseClock(words[1], now)
+		if !ok {
+			return send(api, command.NewMessage(usage))
+		}
+		reminder.Repeat = REMINDER_REPEAT_DAILY
+		reminder.FireAt = at
+		reminder.Text = strings.Join(words[2:], " ")
+	case len(words) >= 4 && words[0] == "weekly":
+		weekday, wok := weekdayNames[strings.ToLower(words[1])]
+		at, ok := parseClock(words[2], now)
+		if !ok || !wok {
+			return send(api, command.NewMessage(usage))
+		}
+		for at.Weekday() != weekday {
+			at = at.AddDate(0, 0, 1)
+		}
+		reminder.Repeat = REMINDER_REPEAT_WEEKLY
+		reminder.FireAt = at
+		reminder.Text = strings.Join(words[3:], " ")
+	default:
+		return send(api, command.NewMessage(usage))
+	}
+	return command.saveReminder(api, &reminder)
+}
+
+func (command *Command) ListReminders(api Sender) error {
+	var reminders []Reminder
+	err := session.Model(&reminders).Where("chat_id = ?", command.tgRequest.Message.Chat.ID).Order("fire_at").Select()
+	if err != nil {
+		return err
+	}
+	if len(reminders) == 0 {
+		return send(api, command.NewMessage(command.tr("reminders_empty")))
+	}
+	lines := make([]string, len(reminders))
+	for i := range reminders {
+		lines[i] = reminders[i].Format(command.lang())
+	}
+	return send(api, command.NewMessage(command.tr("reminders_list", strings.Join(lines, "\n"))))
+}
+
+func (command *Command) DeleteReminder(api Sender, params string) error {
+	id, cerr := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(params), "#"))
+	if cerr != nil {
+		return send(api, command.NewMessage(command.tr("unremind_usage")))
+	}
+	query := session.Model(&Reminder{}).Where("id = ? and chat_id = ?", id, command.tgRequest.Message.Chat.ID)
+	if !command.hasPermission(api, PERMISSION_CHAT_ADMIN) {
+		query = query.Where("user_id = ?", command.tgRequest.Message.From.ID)
+	}
+	res, err := query.Delete()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return send(api, command.NewMessage(command.tr("reminder_not_found")))
+	}
+	wakeReminders()
+	return send(api, command.NewMessage(command.tr("reminder_deleted")))
+}
+
+// reminderChatGone reports send errors which won't go away on retry,
+// such reminders are dropped like delivered ones
+func reminderChatGone(err error) bool {
+	text := err.Error()
+	return strings.Contains(text, "chat not found") ||
+		strings.Contains(text, "bot was kicked") ||
+		strings.Contains(text, "bot was blocked") ||
+		strings.Contains(text, "bot is not a member")
+}
+
+// fireDueReminders sends every reminder whose time has come. One-off reminders
+// are deleted, recurring ones are moved to their next occurrence, so reminders
+// missed while the bot was down are delivered once after the start.
+// A reminder which could not be sent is kept as it is and false is returned.
+func fireDueReminders(api Sender) bool {
+	var due []Reminder
+	now := time.Now()
+	err := session.Model(&due).Where("fire_at <= ?", now).Order("fire_at").Select()
+	if err != nil {
+		log.Printf("[Error] Can`t load reminders: %v", err)
+		return false
+	}
+	delivered := true
+	for i := range due {
+		reminder := &due[i]
+		text := "⏰ " + html.EscapeString(reminder.Text)
+		if reminder.Repeat != REMINDER_REPEAT_NONE {
+			text = "📢 " + html.EscapeString(reminder.Text)
+		}
+		msg := tgbotapi.NewMessage(reminder.ChatId, text)
+		msg.ParseMode = "HTML"
+		_, serr := api.Send(msg)
+		if serr != nil {
+			log.Printf("[Error] Can`t send reminder %v: %v", reminder.Id, serr)
+			if !reminderChatGone(serr) {
+				delivered = false
+				continue
+			}
+		}
+		if reminder.Repeat == REMINDER_REPEAT_NONE {
+			err = session.Delete(reminder)
+		} else {
+			reminder.FireAt = reminder.nextFire(now)
+			_, err = session.Model(reminder).Set("fire_at = ?fire_at").Update()
+		}
+		if err != nil {
+			log.Printf("[Error] Can`t reschedule reminder %v: %v", reminder.Id, err)
+		}
+	}
+	return delivered
+}
+
+// watchReminders sleeps until the nearest reminder or until the reminders table changes
+func watchReminders(api Sender) {
+	for {
+		delivered := fireDueReminders(api)
+		wait := REMINDER_IDLE_WAIT
+		next := Reminder{}
+		err := session.Model(&next).Order("fire_at").Limit(1).Select()
+		if err == nil && time.Until(next.FireAt) < wait {
+			wait = time.Until(next.FireAt)
+		}
+		if !delivered && wait < REMINDER_RETRY_INTERVAL {
+			wait = REMINDER_RETRY_INTERVAL
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-reminderWakeup:
+			timer.Stop()
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRemindTime(t *testing.T) {
+	now := time.Date(2027, time.March, 10, 12, 0, 0, 0, reminderLocation)
+	tests := []struct {
+		text     string
+		at       time.Time
+		consumed int
+		ok       bool
+	}{
+		{"30m raid", now.Add(30 * time.Minute), 1, true},
+		{"18:30 raid", time.Date(2027, time.March, 10, 18, 30, 0, 0, reminderLocation), 1, true},
+		{"11:00 raid", time.Date(2027, time.March, 11, 11, 0, 0, 0, reminderLocation), 1, true},
+		{"31.12 18:30 raid", time.Date(2027, time.December, 31, 18, 30, 0, 0, reminderLocation), 2, true},
+		{"01.01 00:00 raid", time.Date(2028, time.January, 1, 0, 0, 0, 0, reminderLocation), 2, true},
+		{"29.02 10:00 raid", time.Date(2028, time.February, 29, 10, 0, 0, 0, reminderLocation), 2, true},
+		{"31.04 10:00 raid", time.Time{}, 0, false},
+		{"31.02 10:00 raid", time.Time{}, 0, false},
+		{"31.12 raid", time.Time{}, 0, false},
+		{"tomorrow raid", time.Time{}, 0, false},
+	}
+	for _, test := range tests {
+		at, consumed, ok := parseRemindTime(strings.Fields(test.text), now)
+		if ok != test.ok || consumed != test.consumed || !at.Equal(test.at) {
+			t.Errorf("parseRemindTime(%q) = %v, %v, %v, want %v, %v, %v", test.text, at, consumed, ok, test.at, test.consumed, test.ok)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const REPORT_STATUS_OPEN = 0
+const REPORT_STATUS_RESOLVED = 1
+
+var adminChatId = config.Section("admin").Key("chat_id").MustInt64(0)
+
+type Report struct {
+	Id       int
+	UserId   int
+	UserName string
+	ChatId   int64
+	CardId   string
+	Text     string
+	Status   int
+	Created  time.Time
+	Resolved time.Time
+}
+
+func (report *Report) Format(lang string) string {
+	var card string
+	if report.CardId != "" {
+		card = fmt.Sprintf(" [id:%v]", report.CardId)
+	}
+	return tr(lang, "report_line", report.Id, report.Created.Format("02.01 15:04"),
+		card, html.EscapeString(report.UserName), html.EscapeString(report.Text))
+}
+
+// Report stores a problem description. If the text starts with a number
+// it is treated as the id of the card the report is about.
+func (command *Command) Report(api Sender, s string) error {
+	message := command.tgRequest.Message
+	report := Report{
+		UserId:   message.From.ID,
+		UserName: userDisplayName(message.From),
+		ChatId:   message.Chat.ID,
+		Text:     strings.TrimSpace(s),
+		Status:   REPORT_STATUS_OPEN,
+		Created:  time.Now(),
+	}
+	words := strings.Fields(report.Text)
+	if _, err := strconv.Atoi(words[0]); err == nil && len(words) > 1 {
+		report.CardId = words[0]
+		report.Text = strings.Join(words[1:], " ")
+	}
+	err := session.Insert(&report)
+	if err != nil {
+		return err
+	}
+	if adminChatId != 0 {
+		lang := chatLanguageOrDefault(adminChatId)
+		msg := tgbotapi.NewMessage(adminChatId, tr(lang, "report_new", report.Format(lang)))
+		msg.ParseMode = "HTML"
+		// the report is saved and admins see it in /reports, so the reporter is answered anyway
+		if err := send(api, msg); err != nil {
+			log.Printf("[Error] Can`t notify admins about report %v: %v", report.Id, err)
+		}
+	}
+	return send(api, command.NewMessage(command.tr("report_thanks", report.Id)))
+}
+
+func (command *Command) ListReports(api Sender) error {
+	var reports []Report
+	err := session.Model(&reports).Where("status = ?", REPORT_STATUS_OPEN).Order("id").Select()
+	if err != nil {
+		return err
+	}
+	if len(reports) == 0 {
+		return send(api, command.NewMessage(command.tr("reports_empty")))
+	}
+	lines := make([]string, len(reports))
+	for i := range reports {
+		lines[i] = reports[i].Format(command.lang())
+	}
+	return send(api, command.NewMessage(strings.Join(lines, "\n\n")))
+}
+
+// ResolveReport closes the report and lets the reporter know about it.
+// Everything after the id is passed to the reporter as a comment.
+func (command *Command) ResolveReport(api Sender, params string) error {
+	words := strings.Fields(params)
+	id, cerr := strconv.Atoi(strings.TrimPrefix(words[0], "#"))
+	if cerr != nil {
+		return send(api, command.NewMessage(command.tr("resolve_usage")))
+	}
+	report := Report{Id: id}
+	err := session.Select(&report)
+	if err == pg.ErrNoRows {
+		return send(api, command.NewMessage(command.tr("report_not_found", id)))
+	} else if err != nil {
+		return err
+	}
+	if report.Status == REPORT_STATUS_RESOLVED {
+		return send(api, command.NewMessage(command.tr("report_already_resolved", id)))
+	}
+	report.Status = REPORT_STATUS_RESOLVED
+	report.Resolved = time.Now()
+	_, uerr := session.Model(&report).Set("status = ?status, resolved = ?resolved").Update()
+	if uerr != nil {
+		return uerr
+	}
+	text := tr(chatLanguageOrDefault(report.ChatId), "report_resolved_notice", html.EscapeString(report.UserName), report.Id)
+	if len(words) > 1 {
+		text += "\n" + html.EscapeString(strings.Join(words[1:], " "))
+	}
+	msg := tgbotapi.NewMessage(report.ChatId, text)
+	msg.ParseMode = "HTML"
+	if err := send(api, msg); err != nil {
+		return err
+	}
+	return send(api, command.NewMessage(command.tr("report_resolved", id)))
+}
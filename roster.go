@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// telegram doesn't let bots list chat members, so members are remembered
+// when they write to the chat. A known member is saved again only after this timeout.
+const CHAT_MEMBER_SEEN_TIMEOUT = time.Hour
+
+// ChatMember is a user who wrote to a group chat
+type ChatMember struct {
+	ChatId   int64 `sql:",pk"`
+	UserId   int   `sql:",pk"`
+	UserName string
+	LastSeen time.Time
+}
+
+type chatMemberKey struct {
+	chatId int64
+	userId int
+}
+
+type SeenMembers struct {
+	mx    sync.Mutex
+	value map[chatMemberKey]time.Time
+}
+
+var seenMembers = SeenMembers{value: make(map[chatMemberKey]time.Time)}
+
+// RosterRow is a number of owned cards with the same attribute or race
+type RosterRow struct {
+	Name  string
+	Count int
+}
+
+// trackChatMember remembers authors of group messages and forgets members who left
+func trackChatMember(message *tgbotapi.Message) {
+	if message.From == nil || message.Chat.IsPrivate() || message.Chat.IsChannel() {
+		return
+	}
+	if left := message.LeftChatMember; left != nil {
+		seenMembers.mx.Lock()
+		delete(seenMembers.value, chatMemberKey{message.Chat.ID, left.ID})
+		seenMembers.mx.Unlock()
+		err := chatStore.RemoveChatMember(message.Chat.ID, left.ID)
+		if err != nil {
+			log.Printf("[Error] Can`t remove member %v of chat %v: %v", left.ID, message.Chat.ID, err)
+		}
+		return
+	}
+	key := chatMemberKey{message.Chat.ID, message.From.ID}
+	seenMembers.mx.Lock()
+	seen, ok := seenMembers.value[key]
+	if ok && time.Since(seen) < CHAT_MEMBER_SEEN_TIMEOUT {
+		seenMembers.mx.Unlock()
+		return
+	}
+	seenMembers.value[key] = time.Now()
+	seenMembers.mx.Unlock()
+
+	member := ChatMember{
+		ChatId:   message.Chat.ID,
+		UserId:   message.From.ID,
+		UserName: userDisplayName(message.From),
+		LastSeen: time.Now(),
+	}
+	err := chatStore.SaveChatMember(&member)
+	if err != nil {
+		log.Printf("[Error] Can`t save member %v of chat %v: %v", member.UserId, member.ChatId, err)
+	}
+}
+
+// WhoHas lists members of the group chat who own the card
+func (command *Command) WhoHas(api Sender, params string) error {
+	query := strings.TrimSpace(params)
+	if command.isPrivateChat() {
+		return send(api, command.NewMessage(command.tr("group_only")))
+	}
+	if query == "" {
+		return send(api, command.NewMessage(command.tr("whohas_usage")))
+	}
+	card, err := cardStore.FindCard(query)
+	if err != nil {
+		return err
+	}
+	if card == nil {
+		return send(api, command.NewMessage(command.tr("card_not_found")))
+	}
+	var members []ChatMember
+	err = session.Model(&members).
+		Where("chat_id = ?", command.chatId()).
+		Where("user_id IN (SELECT user_id FROM owned_cards WHERE card_id = ?)", card.Card_id).
+		Order("user_name").
+		Select()
+	if err != nil {
+		return err
+	}
+	title := fmt.Sprintf("<b>%v</b> [id:%v]", html.EscapeString(card.Name), card.Card_id)
+	if len(members) == 0 {
+		return send(api, command.NewMessage(command.tr("whohas_nobody", title)))
+	}
+	names := make([]string, len(members))
+	for i, member := range members {
+		names[i] = html.EscapeString(member.UserName)
+	}
+	return send(api, command.NewMessage(command.tr("whohas_title", title)+"\n• "+strings.Join(names, "\n• ")))
+}
+
+// rosterRows counts cards owned by members of the chat grouped by the card column
+func rosterRows(chatId int64, column string) ([]RosterRow, error) {
+	var rows []RosterRow
+	err := session.Model((*OwnedCard)(nil)).
+		ColumnExpr("card.? AS name, count(*) AS count", pg.F(column)).
+		Join("JOIN cards AS card ON card.card_id = owned_card.card_id").
+		Join("JOIN chat_members AS chat_member ON chat_member.user_id = owned_card.user_id").
+		Where("chat_member.chat_id = ?", chatId).
+		GroupExpr("card.?", pg.F(column)).
+		Order("count DESC").
+		Select(&rows)
+	return rows, err
+}
+
+// Roster summarizes cards owned by members of the group chat by attribute and race
+func (command *Command) Roster(api Sender) error {
+	if command.isPrivateChat() {
+		return send(api, command.NewMessage(command.tr("group_only")))
+	}
+	var members, cards int
+	err := session.Model((*OwnedCard)(nil)).
+		ColumnExpr("count(DISTINCT owned_card.user_id) AS members, count(DISTINCT owned_card.card_id) AS cards").
+		Join("JOIN chat_members AS chat_member ON chat_member.user_id = owned_card.user_id").
+		Where("chat_member.chat_id = ?", command.chatId()).
+		Select(pg.Scan(&members, &cards))
+	if err != nil {
+		return err
+	}
+	if members == 0 {
+		return send(api, command.NewMessage(command.tr("roster_empty")))
+	}
+	var b strings.Builder
+	b.WriteString(command.tr("roster_title", members, cards) + "\n")
+	for _, group := range []struct {
+		title  string
+		column string
+	}{
+		{"roster_by_attribute", "attribute"},
+		{"roster_by_race", "race"},
+	} {
+		rows, rerr := rosterRows(command.chatId(), group.column)
+		if rerr != nil {
+			return rerr
+		}
+		b.WriteString("\n<b>" + command.tr(group.title) + "</b>\n")
+		for _, row := range rows {
+			fmt.Fprintf(&b, "• %v: %v\n", html.EscapeString(row.Name), row.Count)
+		}
+	}
+	return send(api, command.NewMessage(b.String()))
+}
@@ -0,0 +1,145 @@
+package main
+
+// schemaMigrations are applied in order on every start,
+// so each statement has to be safe to run more than once
+var schemaMigrations = []string{
+	// tables of polls were created by hand before migrations, a new database gets them here
+	`CREATE TABLE IF NOT EXISTS polls (
+		id serial PRIMARY KEY,
+		name text,
+		created timestamptz,
+		active_until timestamptz,
+		user_id bigint,
+		message_id bigint,
+		chat_id bigint
+	)`,
+	`CREATE TABLE IF NOT EXISTS votes (
+		id serial PRIMARY KEY,
+		poll_id integer,
+		name text,
+		count integer NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS poll_users (
+		poll_id integer,
+		user_id bigint
+	)`,
+	`ALTER TABLE polls ADD COLUMN IF NOT EXISTS public boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE poll_users ADD COLUMN IF NOT EXISTS vote_id bigint`,
+	`ALTER TABLE poll_users ADD COLUMN IF NOT EXISTS user_name text`,
+	// polls which ended before the column appeared are closed right away,
+	// otherwise the watcher would edit all of them at once on the first start
+	`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'polls' AND column_name = 'closed') THEN
+			ALTER TABLE polls ADD COLUMN closed boolean NOT NULL DEFAULT false;
+			UPDATE polls SET closed = true WHERE active_until < now();
+		END IF;
+	END $$`,
+	// keep the first vote of every user before adding the unique constraint
+	`DELETE FROM poll_users a USING poll_users b
+		WHERE a.ctid > b.ctid AND a.poll_id = b.poll_id AND a.user_id = b.user_id`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS poll_users_poll_id_user_id_key ON poll_users (poll_id, user_id)`,
+	`CREATE TABLE IF NOT EXISTS reminders (
+		id serial PRIMARY KEY,
+		chat_id bigint NOT NULL,
+		user_id bigint NOT NULL,
+		text text NOT NULL,
+		fire_at timestamptz NOT NULL,
+		repeat integer NOT NULL DEFAULT 0,
+		created timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS reminders_fire_at_idx ON reminders (fire_at)`,
+	`CREATE TABLE IF NOT EXISTS reports (
+		id serial PRIMARY KEY,
+		user_id bigint NOT NULL,
+		user_name text,
+		chat_id bigint NOT NULL,
+		card_id text,
+		text text NOT NULL,
+		status integer NOT NULL DEFAULT 0,
+		created timestamptz NOT NULL DEFAULT now(),
+		resolved timestamptz
+	)`,
+	`CREATE TABLE IF NOT EXISTS banned_users (
+		user_id bigint PRIMARY KEY,
+		banned_by bigint NOT NULL,
+		reason text,
+		created timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS card_fixes (
+		id serial PRIMARY KEY,
+		card_id text NOT NULL,
+		field text NOT NULL,
+		value text NOT NULL,
+		old_value text,
+		user_id bigint NOT NULL,
+		user_name text,
+		chat_id bigint NOT NULL,
+		status integer NOT NULL DEFAULT 0,
+		reviewed_by bigint,
+		created timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS card_overrides (
+		card_id text NOT NULL,
+		field text NOT NULL,
+		value text NOT NULL,
+		fix_id integer,
+		updated timestamptz NOT NULL DEFAULT now(),
+		PRIMARY KEY (card_id, field)
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_languages (
+		chat_id bigint PRIMARY KEY,
+		language text NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS teams (
+		id serial PRIMARY KEY,
+		user_id bigint NOT NULL,
+		name text NOT NULL,
+		card_ids text[] NOT NULL,
+		created timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS teams_user_id_name_idx ON teams (user_id, name)`,
+	`CREATE TABLE IF NOT EXISTS owned_cards (
+		user_id bigint NOT NULL,
+		card_id text NOT NULL,
+		created timestamptz NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, card_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_members (
+		chat_id bigint NOT NULL,
+		user_id bigint NOT NULL,
+		user_name text,
+		last_seen timestamptz NOT NULL DEFAULT now(),
+		PRIMARY KEY (chat_id, user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS stages (
+		id serial PRIMARY KEY,
+		name text NOT NULL,
+		wiki_link text NOT NULL UNIQUE,
+		floors integer NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS stage_enemies (
+		id serial PRIMARY KEY,
+		stage_id integer NOT NULL REFERENCES stages (id) ON DELETE CASCADE,
+		floor integer NOT NULL,
+		position integer NOT NULL,
+		name text,
+		attribute text,
+		hp bigint NOT NULL DEFAULT 0,
+		attack integer NOT NULL DEFAULT 0,
+		cd integer NOT NULL DEFAULT 0,
+		abilities text,
+		wiki_link text,
+		card_id text
+	)`,
+	`CREATE INDEX IF NOT EXISTS stage_enemies_stage_id_idx ON stage_enemies (stage_id, floor, position)`,
+}
+
+func migrateSchema() error {
+	for _, query := range schemaMigrations {
+		_, err := session.Exec(query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
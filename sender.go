@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// Sender is the part of the Bot API used by handlers, *tgbotapi.BotAPI implements it
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error)
+	AnswerInlineQuery(config tgbotapi.InlineConfig) (tgbotapi.APIResponse, error)
+	GetChatAdministrators(config tgbotapi.ChatConfig) ([]tgbotapi.ChatMember, error)
+}
+
+// send delivers the message when only the error matters
+func send(api Sender, c tgbotapi.Chattable) error {
+	_, err := api.Send(c)
+	return err
+}
+
+// answerCallback stops the loading animation of the button and shows the text if it isn't empty.
+// A failed answer only leaves the button spinning, so the error is logged and the action goes on.
+func answerCallback(api Sender, queryId string, text string) {
+	_, err := api.AnswerCallbackQuery(tgbotapi.NewCallback(queryId, text))
+	if err != nil {
+		log.Printf("[Error] Can`t answer callback query %v: %v", queryId, err)
+	}
+}
+
+// endpointTransport sends Bot API requests to another server, e.g. a local Bot API server.
+// The library has the address of api.telegram.org built in.
+type endpointTransport struct {
+	endpoint *url.URL
+	next     http.RoundTripper
+}
+
+func (transport *endpointTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	redirected := req.Clone(req.Context())
+	redirected.URL.Scheme = transport.endpoint.Scheme
+	redirected.URL.Host = transport.endpoint.Host
+	redirected.URL.Path = strings.TrimSuffix(transport.endpoint.Path, "/") + req.URL.Path
+	redirected.Host = ""
+	return transport.next.RoundTrip(redirected)
+}
+
+// newBotAPI connects to the Bot API at endpoint, an empty endpoint means api.telegram.org
+func newBotAPI(token string, endpoint string, client *http.Client) (*tgbotapi.BotAPI, error) {
+	if endpoint == "" {
+		return tgbotapi.NewBotAPIWithClient(token, client)
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	redirected := *client
+	redirected.Transport = &endpointTransport{endpoint: parsed, next: next}
+	return tgbotapi.NewBotAPIWithClient(token, &redirected)
+}
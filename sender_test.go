@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const TEST_BOT_TOKEN = "123:test"
+
+type fakeCall struct {
+	method string
+	params url.Values
+}
+
+// fakeBotAPI is a Bot API server recording the requests of the bot.
+// Messages are sent and edited successfully unless the method is made to fail.
+type fakeBotAPI struct {
+	mx      sync.Mutex
+	calls   []fakeCall
+	failing map[string]string
+	lastId  int
+}
+
+// newFakeBotAPI starts the server and connects a bot to it
+func newFakeBotAPI(t *testing.T) (*fakeBotAPI, *tgbotapi.BotAPI) {
+	fake := &fakeBotAPI{failing: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	bot, err := newBotAPI(TEST_BOT_TOKEN, server.URL, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot.Self.UserName != "tos_helper_bot" {
+		t.Fatalf("the bot is %q, getMe didn't reach the fake server", bot.Self.UserName)
+	}
+	return fake, bot
+}
+
+func (fake *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/bot" + TEST_BOT_TOKEN + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	method := strings.TrimPrefix(r.URL.Path, prefix)
+	r.ParseForm()
+
+	fake.mx.Lock()
+	defer fake.mx.Unlock()
+	fake.calls = append(fake.calls, fakeCall{method: method, params: r.PostForm})
+	if description, ok := fake.failing[method]; ok {
+		fmt.Fprintf(w, `{"ok":false,"error_code":400,"description":%q}`, description)
+		return
+	}
+	var result interface{}
+	switch method {
+	case "getMe":
+		result = tgbotapi.User{ID: 99, FirstName: "ToS helper", UserName: "tos_helper_bot"}
+	case "getChatAdministrators":
+		result = []tgbotapi.ChatMember{}
+	case "answerCallbackQuery":
+		result = true
+	case "sendMessage", "editMessageText", "editMessageReplyMarkup":
+		chatId, _ := strconv.ParseInt(r.PostForm.Get("chat_id"), 10, 64)
+		messageId, _ := strconv.Atoi(r.PostForm.Get("message_id"))
+		if method == "sendMessage" {
+			fake.lastId++
+			messageId = fake.lastId
+		}
+		result = tgbotapi.Message{MessageID: messageId, Chat: &tgbotapi.Chat{ID: chatId}, Text: r.PostForm.Get("text")}
+	default:
+		fmt.Fprintf(w, `{"ok":false,"error_code":404,"description":"Not Found: method %v"}`, method)
+		return
+	}
+	data, _ := json.Marshal(result)
+	fmt.Fprintf(w, `{"ok":true,"result":%s}`, data)
+}
+
+// fail makes the method answer with the error description
+func (fake *fakeBotAPI) fail(method string, description string) {
+	fake.mx.Lock()
+	fake.failing[method] = description
+	fake.mx.Unlock()
+}
+
+// called returns parameters of the calls of the method
+func (fake *fakeBotAPI) called(method string) []url.Values {
+	fake.mx.Lock()
+	defer fake.mx.Unlock()
+	var params []url.Values
+	for _, call := range fake.calls {
+		if call.method == method {
+			params = append(params, call.params)
+		}
+	}
+	return params
+}
+
+func (fake *fakeBotAPI) last(t *testing.T, method string) url.Values {
+	t.Helper()
+	params := fake.called(method)
+	if len(params) == 0 {
+		t.Fatalf("%v was not called", method)
+	}
+	return params[len(params)-1]
+}
+
+// lastButton returns the callback data of the button of the last sent message starting with the label
+func (fake *fakeBotAPI) lastButton(t *testing.T, label string) string {
+	t.Helper()
+	var markup tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(fake.last(t, "sendMessage").Get("reply_markup")), &markup); err != nil {
+		t.Fatal(err)
+	}
+	return buttonData(t, markup, label)
+}
+
+func callbackUpdate(chatId int64, messageId int, userId int, data string) tgbotapi.Update {
+	message := testMessage(chatId, userId, "")
+	message.MessageID = messageId
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "query" + strconv.Itoa(userId),
+		From:    message.From,
+		Message: message,
+		Data:    data,
+	}}
+}
+
+func TestBotAPIPollVoting(t *testing.T) {
+	store := useMemoryStore(t)
+	fake, bot := newFakeBotAPI(t)
+
+	message := testMessage(TEST_GROUP_ID, TEST_USER_ID, "/poll")
+	message.ReplyToMessage = &tgbotapi.Message{MessageID: 5}
+	handleUpdate(bot, tgbotapi.Update{Message: message})
+	sent := fake.last(t, "sendMessage")
+	if sent.Get("reply_to_message_id") != "5" {
+		t.Errorf("the poll is not a reply to the message: %v", sent)
+	}
+	pollMessageId := fake.lastId
+	vote := fake.lastButton(t, tr(DEFAULT_LANGUAGE, "poll_vote_for"))
+	closeData := fake.lastButton(t, tr(DEFAULT_LANGUAGE, "poll_button_close"))
+
+	script := []struct {
+		userId int
+		data   string
+		answer string
+	}{
+		{TEST_USER_ID, vote, "poll_vote_accepted"},
+		{TEST_USER_ID, vote, "poll_already_voted"},
+		{TEST_OTHER_USER_ID, vote, "poll_vote_accepted"},
+		{TEST_OTHER_USER_ID, closeData, "poll_close_forbidden"},
+		{TEST_USER_ID, closeData, "poll_closed"},
+		{TEST_OTHER_USER_ID, vote, "poll_already_closed"},
+	}
+	for _, step := range script {
+		handleUpdate(bot, callbackUpdate(TEST_GROUP_ID, pollMessageId, step.userId, step.data))
+		answer := fake.last(t, "answerCallbackQuery")
+		if answer.Get("text") != tr(DEFAULT_LANGUAGE, step.answer) {
+			t.Errorf("user %v got %q, want %v", step.userId, answer.Get("text"), step.answer)
+		}
+	}
+
+	edit := fake.last(t, "editMessageText")
+	if edit.Get("message_id") != strconv.Itoa(pollMessageId) || !strings.Contains(edit.Get("text"), tr(DEFAULT_LANGUAGE, "poll_total", 2)) {
+		t.Errorf("the poll message is not replaced with the results: %v", edit)
+	}
+	poll, err := store.PollByMessage(TEST_GROUP_ID, pollMessageId)
+	if err != nil || !poll.Closed {
+		t.Errorf("the poll is not closed: %v", err)
+	}
+}
+
+func TestBotAPIFindCallbacks(t *testing.T) {
+	useMemoryStore(t, testCards()...)
+	fake, bot := newFakeBotAPI(t)
+
+	handleUpdate(bot, tgbotapi.Update{Message: testMessage(TEST_GROUP_ID, TEST_USER_ID, "/f dragon")})
+	messageId := fake.lastId
+	water := fake.lastButton(t, "Water Dragon")
+	save := fake.lastButton(t, tr(DEFAULT_LANGUAGE, "button_ok"))
+
+	handleUpdate(bot, callbackUpdate(TEST_GROUP_ID, messageId, TEST_USER_ID, water))
+	edit := fake.last(t, "editMessageText")
+	if edit.Get("message_id") != strconv.Itoa(messageId) || !strings.Contains(edit.Get("text"), "Water Dragon") {
+		t.Errorf("the message is not switched to the chosen card: %v", edit)
+	}
+
+	handleUpdate(bot, callbackUpdate(TEST_GROUP_ID, messageId, TEST_USER_ID, save))
+	markup := fake.last(t, "editMessageReplyMarkup")
+	if markup.Get("message_id") != strconv.Itoa(messageId) || strings.Contains(markup.Get("reply_markup"), "callback_data") {
+		t.Errorf("buttons are not removed on save: %v", markup)
+	}
+}
+
+func TestBotAPISendError(t *testing.T) {
+	useMemoryStore(t, testCards()...)
+	fake, bot := newFakeBotAPI(t)
+	fake.fail("sendMessage", "Forbidden: bot was blocked by the user")
+
+	err := runMessage(bot, testMessage(TEST_USER_ID, TEST_USER_ID, "/s 1"))
+	if err == nil || !strings.Contains(err.Error(), "bot was blocked") {
+		t.Errorf("error of sendMessage = %v", err)
+	}
+	err = runMessage(bot, testMessage(TEST_GROUP_ID, TEST_USER_ID, "/f dragon"))
+	if err == nil {
+		t.Error("the error of sendMessage is lost with buttons")
+	}
+}
+
+func TestBotAPIPollCloseError(t *testing.T) {
+	store := useMemoryStore(t)
+	fake, bot := newFakeBotAPI(t)
+	message := testMessage(TEST_GROUP_ID, TEST_USER_ID, "/poll")
+	message.ReplyToMessage = &tgbotapi.Message{MessageID: 5}
+	if err := runMessage(bot, message); err != nil {
+		t.Fatal(err)
+	}
+	pollMessageId := fake.lastId
+	closeData := fake.lastButton(t, tr(DEFAULT_LANGUAGE, "poll_button_close"))
+
+	// a failed edit leaves the poll open, so closing can be retried
+	fake.fail("editMessageText", "Too Many Requests: retry after 5")
+	if err := runCallback(bot, TEST_GROUP_ID, pollMessageId, TEST_USER_ID, closeData); err == nil {
+		t.Error("the error of editMessageText is lost")
+	}
+	if poll, _ := store.PollByMessage(TEST_GROUP_ID, pollMessageId); poll.Closed {
+		t.Error("the poll is closed although the results are not shown")
+	}
+
+	// a deleted message can't show the results, the poll is closed anyway
+	fake.fail("editMessageText", "Bad Request: message to edit not found")
+	if err := runCallback(bot, TEST_GROUP_ID, pollMessageId, TEST_USER_ID, closeData); err != nil {
+		t.Error(err)
+	}
+	if poll, _ := store.PollByMessage(TEST_GROUP_ID, pollMessageId); !poll.Closed {
+		t.Error("the poll of a deleted message is not closed")
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-pg/pg"
+)
+
+// attributeCounters maps the attribute of an enemy to the attribute which deals double damage to it
+var attributeCounters = map[string]string{
+	"Fire":  "Water",
+	"Earth": "Fire",
+	"Water": "Earth",
+	"Light": "Dark",
+	"Dark":  "Light",
+}
+
+// Stage is a dungeon stage crawled from the wiki
+type Stage struct {
+	Id       int
+	Name     string
+	WikiLink string
+	Floors   int
+}
+
+type StageEnemy struct {
+	Id        int
+	StageId   int
+	Floor     int
+	Position  int
+	Name      string
+	Attribute string
+	Hp        int
+	Attack    int
+	Cd        int
+	Abilities string
+	WikiLink  string
+	CardId    string
+}
+
+type StageFloor struct {
+	Number   int
+	Enemies  []StageEnemy
+	Counters []string
+}
+
+// StageView is the data of the stage template
+type StageView struct {
+	Stage  *Stage
+	Floors []StageFloor
+}
+
+// counterAttributes returns attributes strong against the enemies, in the order of enemies
+func counterAttributes(enemies []StageEnemy) []string {
+	var counters []string
+	seen := make(map[string]bool)
+	for _, enemy := range enemies {
+		counter, ok := attributeCounters[enemy.Attribute]
+		if ok && !seen[counter] {
+			seen[counter] = true
+			counters = append(counters, counter)
+		}
+	}
+	return counters
+}
+
+func newStageView(stage *Stage, enemies []StageEnemy) *StageView {
+	view := &StageView{Stage: stage}
+	for _, enemy := range enemies {
+		if len(view.Floors) == 0 || view.Floors[len(view.Floors)-1].Number != enemy.Floor {
+			view.Floors = append(view.Floors, StageFloor{Number: enemy.Floor})
+		}
+		floor := &view.Floors[len(view.Floors)-1]
+		floor.Enemies = append(floor.Enemies, enemy)
+	}
+	for i := range view.Floors {
+		view.Floors[i].Counters = counterAttributes(view.Floors[i].Enemies)
+	}
+	return view
+}
+
+// normalizeAttribute turns crawled attributes like "Icon water" into the name used by cards
+func normalizeAttribute(text string) string {
+	if found := findWords(text, cardAttributes, attributeRes); len(found) > 0 {
+		return found[0]
+	}
+	return strings.TrimSpace(text)
+}
+
+// findStage looks the stage up by its name, then by a part of it. Returns nil if nothing is found.
+func findStage(name string) (*Stage, error) {
+	stage := Stage{}
+	err := session.Model(&stage).Where("name ilike ?", name).Limit(1).Select()
+	if err == pg.ErrNoRows {
+		err = session.Model(&stage).Where("name ilike ?", fmt.Sprintf("%%%v%%", name)).
+			Order("name").Limit(1).Select()
+	}
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	return &stage, err
+}
+
+func stageEnemies(stageId int) ([]StageEnemy, error) {
+	var enemies []StageEnemy
+	err := session.Model(&enemies).Where("stage_id = ?", stageId).Order("floor", "position").Select()
+	return enemies, err
+}
+
+// importStages loads parsed_stages.csv written by "parser stages". Stages are matched
+// by their wiki page, enemies are replaced and linked to cards with the same wiki page.
+func importStages(path string) (int, int, error) {
+	rows, err := readCatalogCsv(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	stagesCount, enemiesCount := 0, 0
+	err = session.RunInTransaction(func(tx *pg.Tx) error {
+		var cards []Card
+		err := tx.Model(&cards).Column("card_id", "wiki_link").Select()
+		if err != nil {
+			return err
+		}
+		cardIds := make(map[string]string)
+		for _, card := range cards {
+			cardIds[card.WikiLink] = card.Card_id
+		}
+		stages := make(map[string]*Stage)
+		for _, row := range rows {
+			if len(row) < 10 {
+				continue
+			}
+			stage, ok := stages[row[1]]
+			if !ok {
+				stage = &Stage{Name: row[0], WikiLink: row[1]}
+				_, err = tx.Model(stage).
+					OnConflict("(wiki_link) DO UPDATE").
+					Set("name = EXCLUDED.name").
+					Returning("id").
+					Insert()
+				if err != nil {
+					return err
+				}
+				_, err = tx.Model((*StageEnemy)(nil)).Where("stage_id = ?", stage.Id).Delete()
+				if err != nil {
+					return err
+				}
+				stages[row[1]] = stage
+				stagesCount++
+			}
+			enemy := StageEnemy{
+				StageId:   stage.Id,
+				Name:      row[3],
+				Attribute: normalizeAttribute(row[4]),
+				Abilities: row[8],
+				WikiLink:  row[9],
+				CardId:    cardIds[row[9]],
+			}
+			enemy.Floor, _ = strconv.Atoi(row[2])
+			enemy.Hp, _ = strconv.Atoi(row[5])
+			enemy.Attack, _ = strconv.Atoi(row[6])
+			enemy.Cd, _ = strconv.Atoi(row[7])
+			enemy.Position = enemiesCount
+			if enemy.Floor > stage.Floors {
+				stage.Floors = enemy.Floor
+			}
+			err = tx.Insert(&enemy)
+			if err != nil {
+				return err
+			}
+			enemiesCount++
+		}
+		for _, stage := range stages {
+			_, err = tx.Model(stage).Column("floors").WherePK().Update()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return stagesCount, enemiesCount, err
+}
+
+// importStagesIfExists skips the import when the crawler wasn't run for stages
+func importStagesIfExists(path string) (int, int, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	return importStages(path)
+}
+
+// splitMessage cuts a long message between paragraphs, so html tags stay closed
+func splitMessage(text string) []string {
+	var parts []string
+	var b strings.Builder
+	for _, paragraph := range strings.SplitAfter(text, "\n\n") {
+		if b.Len() > 0 && b.Len()+len(paragraph) > TELEGRAM_MESSAGE_LIMIT {
+			parts = append(parts, b.String())
+			b.Reset()
+		}
+		b.WriteString(paragraph)
+	}
+	return append(parts, b.String())
+}
+
+func (command *Command) ShowStage(api Sender, params string) error {
+	name := strings.TrimSpace(params)
+	if name == "" {
+		return send(api, command.NewMessage(command.tr("stage_usage")))
+	}
+	stage, err := findStage(name)
+	if err != nil {
+		return err
+	}
+	if stage == nil {
+		return send(api, command.NewMessage(command.tr("stage_not_found")))
+	}
+	enemies, err := stageEnemies(stage.Id)
+	if err != nil {
+		return err
+	}
+	res, err := renderTemplate(TEMPLATE_STAGE, command.lang(), newStageView(stage, enemies))
+	if err != nil {
+		return err
+	}
+	for _, part := range splitMessage(res) {
+		msg := command.NewMessage(part)
+		msg.DisableWebPagePreview = true
+		if err := send(api, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
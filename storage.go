@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-redis/redis"
+)
+
+// CardStore looks cards up with their active and leader skills.
+// A missing card is reported with pg.ErrNoRows by every implementation.
+type CardStore interface {
+	CardById(cardId string) (*Card, error)
+	// FindCards returns cards with the name containing the text, the rarest first
+	FindCards(name string, limit int) ([]*Card, error)
+	// FindCard looks the card up by id, then by a part of the name, nil is returned when nothing is found
+	FindCard(query string) (*Card, error)
+	// CardsByIds returns the found cards in no particular order
+	CardsByIds(ids []string) ([]*Card, error)
+	// ExistingCardIds returns which of the ids are known cards
+	ExistingCardIds(ids []string) ([]string, error)
+	// CardsOfAttributes returns cards with their leader skills, only owned ones when ownerId is not 0
+	CardsOfAttributes(attributes []string, ownerId int) ([]*Card, error)
+	// OwnedCards returns cards in the box of the user ordered by id
+	OwnedCards(userId int) ([]*Card, error)
+}
+
+// ChatStore keeps settings of chats and what is known about their members
+type ChatStore interface {
+	// ChatLanguage returns "" when no language was selected
+	ChatLanguage(chatId int64) (string, error)
+	SetChatLanguage(chatId int64, lang string) error
+	// OwnedCardIds returns which of the cards the user owns
+	OwnedCardIds(userId int, cardIds []string) (map[string]bool, error)
+	// AddOwnedCards and RemoveOwnedCards return how many cards were added to or removed from the box
+	AddOwnedCards(userId int, cardIds []string) (int, error)
+	RemoveOwnedCards(userId int, cardIds []string) (int, error)
+	SaveChatMember(member *ChatMember) error
+	RemoveChatMember(chatId int64, userId int) error
+}
+
+// PollStore keeps polls, a missing poll is reported with pg.ErrNoRows
+type PollStore interface {
+	// CreatePoll saves the poll and its options, ids are set on the poll and the returned votes
+	CreatePoll(poll *Poll, options []string) ([]Vote, error)
+	PollById(pollId int) (*Poll, error)
+	PollByMessage(chatId int64, messageId int) (*Poll, error)
+	SetPollMessage(poll *Poll) error
+	// ClosePoll returns false if the poll was already closed
+	ClosePoll(poll *Poll) (bool, error)
+	ActivePolls() ([]*Poll, error)
+}
+
+// VoteStore keeps poll options and the choices of users
+type VoteStore interface {
+	VoteById(voteId int) (*Vote, error)
+	PollVotes(pollId int) ([]Vote, error)
+	PollVoters(pollId int) ([]PollUser, error)
+	// RecordVote returns false if the user has already voted in the poll
+	RecordVote(pollUser *PollUser) (bool, error)
+}
+
+// CallbackStateStore keeps the state of message buttons and conversations for ttl,
+// id is the message of the buttons or the user talking to the bot
+type CallbackStateStore interface {
+	SaveState(feature string, chatId int64, id int, data string, ttl time.Duration) error
+	// LoadState returns false when the state has expired
+	LoadState(feature string, chatId int64, id int) (string, bool, error)
+	DeleteState(feature string, chatId int64, id int) error
+}
+
+var pgStorage = &pgStore{db: session}
+
+var cardStore CardStore = pgStorage
+var chatStore ChatStore = pgStorage
+var pollStore PollStore = pgStorage
+var voteStore VoteStore = pgStorage
+var stateStore CallbackStateStore = &redisStateStore{client: client}
+
+// pgStore keeps cards, polls and votes in postgres
+type pgStore struct {
+	db *pg.DB
+}
+
+func (store *pgStore) CardById(cardId string) (*Card, error) {
+	card := Card{}
+	err := store.db.Model(&card).Column("ActiveSkill", "LeaderSkill").
+		Where("card_id = ?", cardId).Limit(1).Select()
+	if err != nil {
+		return &card, err
+	}
+	card.dropMissingSkills()
+	return &card, applySkillOverrides(store.db, []*Card{&card})
+}
+
+func (store *pgStore) FindCards(name string, limit int) ([]*Card, error) {
+	var cards []*Card
+	err := store.db.Model(&cards).Column("ActiveSkill", "LeaderSkill").
+		Where("card.name ilike ?", fmt.Sprintf("%%%v%%", name)).Order("card.rarity DESC").Limit(limit).Select()
+	if err != nil {
+		return nil, err
+	}
+	for _, card := range cards {
+		card.dropMissingSkills()
+	}
+	return cards, applySkillOverrides(store.db, cards)
+}
+
+func (store *pgStore) FindCard(query string) (*Card, error) {
+	card := Card{}
+	err := store.db.Model(&card).Where("card_id = ?", query).Limit(1).Select()
+	if err == pg.ErrNoRows {
+		err = store.db.Model(&card).Where("name ilike ?", fmt.Sprintf("%%%v%%", query)).
+			Order("rarity DESC").Limit(1).Select()
+	}
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	return &card, err
+}
+
+func (store *pgStore) CardsByIds(ids []string) ([]*Card, error) {
+	var cards []*Card
+	err := store.db.Model(&cards).Column("ActiveSkill", "LeaderSkill").
+		Where("card.card_id IN (?)", pg.In(ids)).Select()
+	if err != nil {
+		return nil, err
+	}
+	for _, card := range cards {
+		card.dropMissingSkills()
+	}
+	return cards, applySkillOverrides(store.db, cards)
+}
+
+func (store *pgStore) ExistingCardIds(ids []string) ([]string, error) {
+	var known []string
+	err := store.db.Model((*Card)(nil)).Column("card_id").Where("card_id IN (?)", pg.In(ids)).Select(&known)
+	return known, err
+}
+
+func (store *pgStore) CardsOfAttributes(attributes []string, ownerId int) ([]*Card, error) {
+	var cards []*Card
+	query := store.db.Model(&cards).Column("LeaderSkill").Where("card.attribute IN (?)", pg.In(attributes))
+	if ownerId != 0 {
+		query = query.Where("card.card_id IN (SELECT card_id FROM owned_cards WHERE user_id = ?)", ownerId)
+	}
+	err := query.Select()
+	if err != nil {
+		return nil, err
+	}
+	for _, card := range cards {
+		card.dropMissingSkills()
+	}
+	return cards, applySkillOverrides(store.db, cards)
+}
+
+func (store *pgStore) OwnedCards(userId int) ([]*Card, error) {
+	var cards []*Card
+	err := store.db.Model(&cards).
+		Where("card_id IN (SELECT card_id FROM owned_cards WHERE user_id = ?)", userId).
+		OrderExpr("length(card_id), card_id").
+		Select()
+	return cards, err
+}
+
+func (store *pgStore) ChatLanguage(chatId int64) (string, error) {
+	setting := ChatLanguage{ChatId: chatId}
+	err := store.db.Select(&setting)
+	if err == pg.ErrNoRows {
+		return "", nil
+	}
+	return setting.Language, err
+}
+
+func (store *pgStore) SetChatLanguage(chatId int64, lang string) error {
+	setting := ChatLanguage{ChatId: chatId, Language: lang}
+	_, err := store.db.Model(&setting).OnConflict("(chat_id) DO UPDATE").Set("language = EXCLUDED.language").Insert()
+	return err
+}
+
+func (store *pgStore) OwnedCardIds(userId int, cardIds []string) (map[string]bool, error) {
+	owned := make(map[string]bool)
+	if len(cardIds) == 0 {
+		return owned, nil
+	}
+	var cards []OwnedCard
+	err := store.db.Model(&cards).Where("user_id = ? AND card_id IN (?)", userId, pg.In(cardIds)).Select()
+	if err != nil {
+		return nil, err
+	}
+	for _, card := range cards {
+		owned[card.CardId] = true
+	}
+	return owned, nil
+}
+
+func (store *pgStore) AddOwnedCards(userId int, cardIds []string) (int, error) {
+	added := 0
+	for _, id := range cardIds {
+		card := OwnedCard{UserId: userId, CardId: id, Created: time.Now()}
+		res, err := store.db.Model(&card).OnConflict("(user_id, card_id) DO NOTHING").Insert()
+		if err != nil {
+			return added, err
+		}
+		added += res.RowsAffected()
+	}
+	return added, nil
+}
+
+func (store *pgStore) RemoveOwnedCards(userId int, cardIds []string) (int, error) {
+	res, err := store.db.Model((*OwnedCard)(nil)).Where("user_id = ? AND card_id IN (?)", userId, pg.In(cardIds)).Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+func (store *pgStore) SaveChatMember(member *ChatMember) error {
+	_, err := store.db.Model(member).
+		OnConflict("(chat_id, user_id) DO UPDATE").
+		Set("user_name = EXCLUDED.user_name, last_seen = EXCLUDED.last_seen").
+		Insert()
+	return err
+}
+
+func (store *pgStore) RemoveChatMember(chatId int64, userId int) error {
+	_, err := store.db.Model((*ChatMember)(nil)).Where("chat_id = ? AND user_id = ?", chatId, userId).Delete()
+	return err
+}
+
+func (store *pgStore) CreatePoll(poll *Poll, options []string) ([]Vote, error) {
+	votes := make([]Vote, len(options))
+	err := store.db.RunInTransaction(func(tx *pg.Tx) error {
+		err := tx.Insert(poll)
+		if err != nil {
+			return err
+		}
+		for i, option := range options {
+			votes[i] = Vote{Name: option, PollId: poll.Id}
+		}
+		_, err = tx.Model(&votes).Insert()
+		return err
+	})
+	return votes, err
+}
+
+func (store *pgStore) PollById(pollId int) (*Poll, error) {
+	poll := Poll{Id: pollId}
+	err := store.db.Select(&poll)
+	return &poll, err
+}
+
+func (store *pgStore) PollByMessage(chatId int64, messageId int) (*Poll, error) {
+	poll := Poll{}
+	err := store.db.Model(&poll).
+		Where("chat_id = ? and message_id = ?", chatId, messageId).
+		Limit(1).Select()
+	return &poll, err
+}
+
+func (store *pgStore) SetPollMessage(poll *Poll) error {
+	_, err := store.db.Model(poll).Set("message_id = ?message_id").WherePK().Update()
+	return err
+}
+
+func (store *pgStore) ClosePoll(poll *Poll) (bool, error) {
+	res, err := store.db.Model(poll).Set("closed = true").Where("id = ?id AND closed = false").Update()
+	if err != nil {
+		return false, err
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+	poll.Closed = true
+	return true, nil
+}
+
+func (store *pgStore) ActivePolls() ([]*Poll, error) {
+	var polls []*Poll
+	err := store.db.Model(&polls).Where("closed = false").Select()
+	return polls, err
+}
+
+func (store *pgStore) VoteById(voteId int) (*Vote, error) {
+	vote := Vote{Id: voteId}
+	err := store.db.Select(&vote)
+	return &vote, err
+}
+
+func (store *pgStore) PollVotes(pollId int) ([]Vote, error) {
+	var votes []Vote
+	err := store.db.Model(&votes).Where("poll_id = ?", pollId).Order("id").Select()
+	return votes, err
+}
+
+func (store *pgStore) PollVoters(pollId int) ([]PollUser, error) {
+	var voters []PollUser
+	err := store.db.Model(&voters).Where("poll_id = ?", pollId).Select()
+	return voters, err
+}
+
+// RecordVote stores the user's choice and recounts the chosen option from poll_users in a single
+// transaction. The poll row is locked, so votes of a poll are recorded one by one.
+func (store *pgStore) RecordVote(pollUser *PollUser) (bool, error) {
+	voted := false
+	err := store.db.RunInTransaction(func(tx *pg.Tx) error {
+		_, err := tx.Exec("SELECT id FROM polls WHERE id = ? FOR UPDATE", pollUser.PollId)
+		if err != nil {
+			return err
+		}
+		res, err := tx.Model(pollUser).OnConflict("(poll_id, user_id) DO NOTHING").Insert()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return nil
+		}
+		voted = true
+		_, uerr := tx.Model((*Vote)(nil)).
+			Set("count = (SELECT count(*) FROM poll_users AS pu WHERE pu.vote_id = vote.id)").
+			Where("id = ? AND poll_id = ?", pollUser.VoteId, pollUser.PollId).
+			Update()
+		return uerr
+	})
+	return voted, err
+}
+
+// redisStateStore keeps the state of buttons in redis, keys expire by themselves
+type redisStateStore struct {
+	client *redis.Client
+}
+
+func (store *redisStateStore) SaveState(feature string, chatId int64, id int, data string, ttl time.Duration) error {
+	return store.client.Set(callbackStateKey(feature, chatId, id), data, ttl).Err()
+}
+
+func (store *redisStateStore) LoadState(feature string, chatId int64, id int) (string, bool, error) {
+	data, err := store.client.Get(callbackStateKey(feature, chatId, id)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return data, true, nil
+}
+
+func (store *redisStateStore) DeleteState(feature string, chatId int64, id int) error {
+	return store.client.Del(callbackStateKey(feature, chatId, id)).Err()
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg"
+)
+
+// memoryStore implements all storage interfaces in memory, so handlers
+// can be run without postgres and redis. Missing rows are reported like postgres does.
+type memoryStore struct {
+	mx      sync.Mutex
+	cards   []*Card
+	polls   map[int]*Poll
+	votes   map[int]*Vote
+	voters  []PollUser
+	states  map[string]memoryState
+	counter int
+	// chat settings and members
+	languages map[int64]string
+	owned     map[int]map[string]bool
+	members   map[chatMemberKey]ChatMember
+}
+
+var _ CardStore = (*memoryStore)(nil)
+var _ PollStore = (*memoryStore)(nil)
+var _ VoteStore = (*memoryStore)(nil)
+var _ CallbackStateStore = (*memoryStore)(nil)
+var _ ChatStore = (*memoryStore)(nil)
+
+type memoryState struct {
+	data    string
+	expires time.Time
+}
+
+func newMemoryStore(cards ...*Card) *memoryStore {
+	return &memoryStore{
+		cards:     cards,
+		polls:     make(map[int]*Poll),
+		votes:     make(map[int]*Vote),
+		states:    make(map[string]memoryState),
+		languages: make(map[int64]string),
+		owned:     make(map[int]map[string]bool),
+		members:   make(map[chatMemberKey]ChatMember),
+	}
+}
+
+func (store *memoryStore) nextId() int {
+	store.counter++
+	return store.counter
+}
+
+func (store *memoryStore) CardById(cardId string) (*Card, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	for _, card := range store.cards {
+		if card.Card_id == cardId {
+			found := *card
+			return &found, nil
+		}
+	}
+	return &Card{}, pg.ErrNoRows
+}
+
+func (store *memoryStore) FindCards(name string, limit int) ([]*Card, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	var cards []*Card
+	for _, card := range store.cards {
+		if strings.Contains(strings.ToLower(card.Name), strings.ToLower(name)) {
+			found := *card
+			cards = append(cards, &found)
+		}
+	}
+	sort.SliceStable(cards, func(i, j int) bool {
+		return cards[i].Rarity > cards[j].Rarity
+	})
+	if len(cards) > limit {
+		cards = cards[:limit]
+	}
+	return cards, nil
+}
+
+func (store *memoryStore) FindCard(query string) (*Card, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	var found *Card
+	for _, card := range store.cards {
+		if card.Card_id == query {
+			found = card
+			break
+		}
+		if strings.Contains(strings.ToLower(card.Name), strings.ToLower(query)) && (found == nil || card.Rarity > found.Rarity) {
+			found = card
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	card := *found
+	return &card, nil
+}
+
+func (store *memoryStore) CardsByIds(ids []string) ([]*Card, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var cards []*Card
+	for _, card := range store.cards {
+		if wanted[card.Card_id] {
+			found := *card
+			cards = append(cards, &found)
+		}
+	}
+	return cards, nil
+}
+
+func (store *memoryStore) ExistingCardIds(ids []string) ([]string, error) {
+	cards, err := store.CardsByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	known := make([]string, len(cards))
+	for i, card := range cards {
+		known[i] = card.Card_id
+	}
+	return known, nil
+}
+
+func (store *memoryStore) CardsOfAttributes(attributes []string, ownerId int) ([]*Card, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	var cards []*Card
+	for _, card := range store.cards {
+		if ownerId != 0 && !store.owned[ownerId][card.Card_id] {
+			continue
+		}
+		for _, attribute := range attributes {
+			if card.Attribute == attribute {
+				found := *card
+				cards = append(cards, &found)
+				break
+			}
+		}
+	}
+	return cards, nil
+}
+
+func (store *memoryStore) OwnedCards(userId int) ([]*Card, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	var cards []*Card
+	for _, card := range store.cards {
+		if store.owned[userId][card.Card_id] {
+			found := *card
+			cards = append(cards, &found)
+		}
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		if len(cards[i].Card_id) != len(cards[j].Card_id) {
+			return len(cards[i].Card_id) < len(cards[j].Card_id)
+		}
+		return cards[i].Card_id < cards[j].Card_id
+	})
+	return cards, nil
+}
+
+func (store *memoryStore) ChatLanguage(chatId int64) (string, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	return store.languages[chatId], nil
+}
+
+func (store *memoryStore) SetChatLanguage(chatId int64, lang string) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	store.languages[chatId] = lang
+	return nil
+}
+
+func (store *memoryStore) OwnedCardIds(userId int, cardIds []string) (map[string]bool, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	owned := make(map[string]bool)
+	for _, id := range cardIds {
+		if store.owned[userId][id] {
+			owned[id] = true
+		}
+	}
+	return owned, nil
+}
+
+func (store *memoryStore) AddOwnedCards(userId int, cardIds []string) (int, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	if store.owned[userId] == nil {
+		store.owned[userId] = make(map[string]bool)
+	}
+	added := 0
+	for _, id := range cardIds {
+		if !store.owned[userId][id] {
+			store.owned[userId][id] = true
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (store *memoryStore) RemoveOwnedCards(userId int, cardIds []string) (int, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	removed := 0
+	for _, id := range cardIds {
+		if store.owned[userId][id] {
+			delete(store.owned[userId], id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (store *memoryStore) SaveChatMember(member *ChatMember) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	store.members[chatMemberKey{member.ChatId, member.UserId}] = *member
+	return nil
+}
+
+func (store *memoryStore) RemoveChatMember(chatId int64, userId int) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	delete(store.members, chatMemberKey{chatId, userId})
+	return nil
+}
+
+func (store *memoryStore) CreatePoll(poll *Poll, options []string) ([]Vote, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	poll.Id = store.nextId()
+	saved := *poll
+	store.polls[poll.Id] = &saved
+	votes := make([]Vote, len(options))
+	for i, option := range options {
+		votes[i] = Vote{Id: store.nextId(), Name: option, PollId: poll.Id}
+		vote := votes[i]
+		store.votes[vote.Id] = &vote
+	}
+	return votes, nil
+}
+
+func (store *memoryStore) PollById(pollId int) (*Poll, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	poll, ok := store.polls[pollId]
+	if !ok {
+		return &Poll{Id: pollId}, pg.ErrNoRows
+	}
+	found := *poll
+	return &found, nil
+}
+
+func (store *memoryStore) PollByMessage(chatId int64, messageId int) (*Poll, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	for _, poll := range store.polls {
+		if poll.ChatId == chatId && poll.MessageId == messageId {
+			found := *poll
+			return &found, nil
+		}
+	}
+	return &Poll{}, pg.ErrNoRows
+}
+
+func (store *memoryStore) SetPollMessage(poll *Poll) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	saved, ok := store.polls[poll.Id]
+	if !ok {
+		return pg.ErrNoRows
+	}
+	saved.MessageId = poll.MessageId
+	return nil
+}
+
+func (store *memoryStore) ClosePoll(poll *Poll) (bool, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	saved, ok := store.polls[poll.Id]
+	if !ok || saved.Closed {
+		return false, nil
+	}
+	saved.Closed = true
+	poll.Closed = true
+	return true, nil
+}
+
+func (store *memoryStore) ActivePolls() ([]*Poll, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	var polls []*Poll
+	for _, poll := range store.polls {
+		if !poll.Closed {
+			found := *poll
+			polls = append(polls, &found)
+		}
+	}
+	return polls, nil
+}
+
+func (store *memoryStore) VoteById(voteId int) (*Vote, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	vote, ok := store.votes[voteId]
+	if !ok {
+		return &Vote{Id: voteId}, pg.ErrNoRows
+	}
+	found := *vote
+	return &found, nil
+}
+
+func (store *memoryStore) PollVotes(pollId int) ([]Vote, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	var votes []Vote
+	for _, vote := range store.votes {
+		if vote.PollId == pollId {
+			votes = append(votes, *vote)
+		}
+	}
+	sort.Slice(votes, func(i, j int) bool {
+		return votes[i].Id < votes[j].Id
+	})
+	return votes, nil
+}
+
+func (store *memoryStore) PollVoters(pollId int) ([]PollUser, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	var voters []PollUser
+	for _, voter := range store.voters {
+		if voter.PollId == pollId {
+			voters = append(voters, voter)
+		}
+	}
+	return voters, nil
+}
+
+func (store *memoryStore) RecordVote(pollUser *PollUser) (bool, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	for _, voter := range store.voters {
+		if voter.PollId == pollUser.PollId && voter.UserId == pollUser.UserId {
+			return false, nil
+		}
+	}
+	vote, ok := store.votes[pollUser.VoteId]
+	if !ok {
+		return false, pg.ErrNoRows
+	}
+	store.voters = append(store.voters, *pollUser)
+	vote.Count++
+	return true, nil
+}
+
+func (store *memoryStore) SaveState(feature string, chatId int64, id int, data string, ttl time.Duration) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	state := memoryState{data: data}
+	if ttl > 0 {
+		state.expires = time.Now().Add(ttl)
+	}
+	store.states[callbackStateKey(feature, chatId, id)] = state
+	return nil
+}
+
+func (store *memoryStore) LoadState(feature string, chatId int64, id int) (string, bool, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	key := callbackStateKey(feature, chatId, id)
+	state, ok := store.states[key]
+	if !ok {
+		return "", false, nil
+	}
+	if !state.expires.IsZero() && time.Now().After(state.expires) {
+		delete(store.states, key)
+		return "", false, nil
+	}
+	return state.data, true, nil
+}
+
+func (store *memoryStore) DeleteState(feature string, chatId int64, id int) error {
+	store.mx.Lock()
+	delete(store.states, callbackStateKey(feature, chatId, id))
+	store.mx.Unlock()
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg"
+)
+
+// postgres tests run when TOSGOBOT_TEST_DATABASE is set to a postgres:// url of a disposable database
+const TEST_DATABASE_ENV = "TOSGOBOT_TEST_DATABASE"
+
+const HAMMER_VOTERS = 50
+
+// testDatabase connects to the test database and migrates it
+func testDatabase(t *testing.T) *pg.DB {
+	addr := os.Getenv(TEST_DATABASE_ENV)
+	if addr == "" {
+		t.Skipf("%v is not set", TEST_DATABASE_ENV)
+	}
+	options, err := pg.ParseURL(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.PoolSize = HAMMER_VOTERS
+	db := pg.Connect(options)
+	oldSession := session
+	session = db
+	t.Cleanup(func() {
+		session = oldSession
+		db.Close()
+	})
+	if err := migrateSchema(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestRecordVoteConcurrently lets many users vote for the options of a poll at once,
+// every vote has to be counted for the option it was given to
+func TestRecordVoteConcurrently(t *testing.T) {
+	db := testDatabase(t)
+	store := &pgStore{db: db}
+	poll := Poll{Name: "hammer", Created: time.Now(), ActiveUntil: time.Now().Add(time.Hour), ChatId: -100}
+	options, err := store.CreatePoll(&poll, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		db.Exec("DELETE FROM poll_users WHERE poll_id = ?", poll.Id)
+		db.Exec("DELETE FROM votes WHERE poll_id = ?", poll.Id)
+		db.Exec("DELETE FROM polls WHERE id = ?", poll.Id)
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*HAMMER_VOTERS)
+	for user := 1; user <= HAMMER_VOTERS; user++ {
+		// every user clicks twice, the second click must not be counted
+		for click := 0; click < 2; click++ {
+			wg.Add(1)
+			go func(userId int, voteId int) {
+				defer wg.Done()
+				_, err := store.RecordVote(&PollUser{PollId: poll.Id, UserId: userId, VoteId: voteId, UserName: "user"})
+				if err != nil {
+					errs <- err
+				}
+			}(user, options[(user+click)%len(options)].Id)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	votes, err := store.PollVotes(poll.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voters, err := store.PollVoters(poll.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(voters) != HAMMER_VOTERS {
+		t.Errorf("%v voters recorded, want %v", len(voters), HAMMER_VOTERS)
+	}
+	chosen := make(map[int]int)
+	for _, voter := range voters {
+		chosen[voter.VoteId]++
+	}
+	total := 0
+	for _, vote := range votes {
+		total += vote.Count
+		if vote.Count != chosen[vote.Id] {
+			t.Errorf("option %q counts %v votes, %v users chose it", vote.Name, vote.Count, chosen[vote.Id])
+		}
+	}
+	if total != HAMMER_VOTERS {
+		t.Errorf("%v votes counted, want %v", total, HAMMER_VOTERS)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// a team is the leader, four members and the friend's leader
+const TEAM_SIZE = 6
+
+// prefix of inline queries created by the share button, followed by the team id
+const TEAM_INLINE_QUERY = "team"
+
+// Team is a named team saved with /team save
+type Team struct {
+	Id      int
+	UserId  int
+	Name    string
+	CardIds []string `sql:",array"`
+	Created time.Time
+}
+
+// TeamView is the data of the team and damage templates
+type TeamView struct {
+	Name     string
+	Leader   *Card
+	Members  []*Card
+	Friend   *Card
+	Hp       int
+	Recovery int
+	Cost     int
+	Estimate *TeamEstimate
+}
+
+func newTeamView(name string, cards []*Card) *TeamView {
+	view := &TeamView{
+		Name:    name,
+		Leader:  cards[0],
+		Members: cards[1 : TEAM_SIZE-1],
+		Friend:  cards[TEAM_SIZE-1],
+	}
+	view.Estimate = newTeamEstimate(view.Leader, view.Friend, cards)
+	for i, card := range cards {
+		view.Hp += card.Max_hp
+		view.Recovery += card.Max_rec
+		// the friend's card doesn't take the team cost
+		if i < TEAM_SIZE-1 {
+			view.Cost += card.Cost
+		}
+	}
+	return view
+}
+
+// loadTeamCards returns cards in the order of ids, the second value is the first id
+// which is not found. The same card may be used several times, e.g. as the friend.
+func loadTeamCards(ids []string) ([]*Card, string, error) {
+	found, err := cardStore.CardsByIds(ids)
+	if err != nil {
+		return nil, "", err
+	}
+	byId := make(map[string]*Card)
+	for _, card := range found {
+		byId[card.Card_id] = card
+	}
+	cards := make([]*Card, len(ids))
+	for i, id := range ids {
+		card, ok := byId[id]
+		if !ok {
+			return nil, id, nil
+		}
+		cards[i] = card
+	}
+	return cards, "", nil
+}
+
+// renderTeam loads the cards and renders the team with the team or damage template,
+// an unknown card is reported as a message
+func renderTeam(templateName string, lang string, name string, ids []string) (string, error) {
+	cards, missing, err := loadTeamCards(ids)
+	if err != nil {
+		return "", err
+	}
+	if missing != "" {
+		return tr(lang, "team_card_not_found", html.EscapeString(missing)), nil
+	}
+	return renderTemplate(templateName, lang, newTeamView(name, cards))
+}
+
+func teamShareMarkup(lang string, team *Team) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonSwitch(tr(lang, "team_button_share"), fmt.Sprintf("%v %v", TEAM_INLINE_QUERY, team.Id)),
+	))
+}
+
+func (command *Command) sendTeam(api Sender, team *Team) error {
+	res, err := renderTeam(TEMPLATE_TEAM, command.lang(), team.Name, team.CardIds)
+	if err != nil {
+		return err
+	}
+	msg := command.NewMessage(res)
+	msg.DisableWebPagePreview = true
+	if team.Id != 0 {
+		msg.ReplyMarkup = teamShareMarkup(command.lang(), team)
+	}
+	return send(api, msg)
+}
+
+// Team handles /team [6 ids], /team save [name] [6 ids], /team delete [name] and /team [name]
+func (command *Command) Team(api Sender, params string) error {
+	words := strings.Fields(params)
+	userId := command.fromUser().ID
+	switch {
+	case len(words) == 0:
+		return command.startConversation(api, "team", "")
+	case words[0] == "save":
+		if len(words) < TEAM_SIZE+2 {
+			return send(api, command.NewMessage(command.tr("team_usage")))
+		}
+		ids := words[len(words)-TEAM_SIZE:]
+		team := Team{
+			UserId:  userId,
+			Name:    strings.Join(words[1:len(words)-TEAM_SIZE], " "),
+			CardIds: ids,
+			Created: time.Now(),
+		}
+		_, missing, err := loadTeamCards(ids)
+		if err != nil {
+			return err
+		}
+		if missing != "" {
+			return send(api, command.NewMessage(command.tr("team_card_not_found", html.EscapeString(missing))))
+		}
+		_, err = session.Model(&team).
+			OnConflict("(user_id, name) DO UPDATE").
+			Set("card_ids = EXCLUDED.card_ids").
+			Returning("id").
+			Insert()
+		if err != nil {
+			return err
+		}
+		if err := send(api, command.NewMessage(command.tr("team_saved", html.EscapeString(team.Name)))); err != nil {
+			return err
+		}
+		return command.sendTeam(api, &team)
+	case words[0] == "delete" && len(words) > 1:
+		name := strings.Join(words[1:], " ")
+		res, err := session.Model(&Team{}).Where("user_id = ? AND name = ?", userId, name).Delete()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return send(api, command.NewMessage(command.tr("team_not_found")))
+		}
+		return send(api, command.NewMessage(command.tr("team_deleted", html.EscapeString(name))))
+	case len(words) == TEAM_SIZE:
+		return command.sendTeam(api, &Team{CardIds: words})
+	default:
+		team, err := findTeam(userId, strings.Join(words, " "))
+		if err != nil {
+			return err
+		}
+		if team == nil {
+			return send(api, command.NewMessage(command.tr("team_not_found")))
+		}
+		return command.sendTeam(api, team)
+	}
+}
+
+// teamFlow builds a team step by step when /team is sent without parameters
+var teamFlow = &conversationFlow{
+	steps: []conversationStep{
+		{ask("team_ask_leader"), checkCardIds(1)},
+		{ask("team_ask_members"), checkCardIds(TEAM_SIZE - 2)},
+		{ask("team_ask_friend"), checkCardIds(1)},
+		{ask("team_ask_name"), checkAnything},
+	},
+	finish: func(command *Command, api Sender, params string, answers []string) error {
+		ids := strings.Join(answers[:3], " ")
+		if answers[3] == "-" {
+			return command.Team(api, ids)
+		}
+		return command.Team(api, "save "+answers[3]+" "+ids)
+	},
+}
+
+// findTeam returns the team saved by the user, nil if there is no such team
+func findTeam(userId int, name string) (*Team, error) {
+	team := Team{}
+	err := session.Model(&team).Where("user_id = ? AND name = ?", userId, name).Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	return &team, err
+}
+
+// Damage handles /dmg [6 ids] and /dmg [name of a saved team]
+func (command *Command) Damage(api Sender, params string) error {
+	words := strings.Fields(params)
+	team := &Team{CardIds: words}
+	if len(words) == 0 {
+		return send(api, command.NewMessage(command.tr("dmg_usage")))
+	} else if len(words) != TEAM_SIZE {
+		var err error
+		team, err = findTeam(command.fromUser().ID, strings.Join(words, " "))
+		if err != nil {
+			return err
+		}
+		if team == nil {
+			return send(api, command.NewMessage(command.tr("team_not_found")))
+		}
+	}
+	res, err := renderTeam(TEMPLATE_DAMAGE, command.lang(), team.Name, team.CardIds)
+	if err != nil {
+		return err
+	}
+	msg := command.NewMessage(res)
+	msg.DisableWebPagePreview = true
+	return send(api, msg)
+}
+
+// ListTeams shows teams saved by the user
+func (command *Command) ListTeams(api Sender) error {
+	var teams []Team
+	err := session.Model(&teams).Where("user_id = ?", command.fromUser().ID).Order("name").Select()
+	if err != nil {
+		return err
+	}
+	if len(teams) == 0 {
+		return send(api, command.NewMessage(command.tr("teams_empty")))
+	}
+	var b strings.Builder
+	b.WriteString(command.tr("teams_title") + "\n")
+	for _, team := range teams {
+		fmt.Fprintf(&b, "• <b>%v</b>: %v\n", html.EscapeString(team.Name), strings.Join(team.CardIds, " "))
+	}
+	return send(api, command.NewMessage(b.String()))
+}
+
+// answerTeamQuery answers the inline query sent by the share button with the rendered team
+func answerTeamQuery(api Sender, query *tgbotapi.InlineQuery) error {
+	lang, ok := normalizeLanguage(query.From.LanguageCode)
+	if !ok {
+		lang = DEFAULT_LANGUAGE
+	}
+	answer := tgbotapi.InlineConfig{InlineQueryID: query.ID, IsPersonal: true, Results: []interface{}{}}
+	words := strings.Fields(query.Query)
+	if len(words) == 2 && words[0] == TEAM_INLINE_QUERY && !isBanned(query.From.ID) {
+		teamId, _ := strconv.Atoi(words[1])
+		team := Team{Id: teamId}
+		err := session.Select(&team)
+		if err != nil && err != pg.ErrNoRows {
+			log.Printf("[Error] Can`t load team %v: %v", teamId, err)
+		}
+		if err == nil {
+			res, rerr := renderTeam(TEMPLATE_TEAM, lang, team.Name, team.CardIds)
+			if rerr != nil {
+				return rerr
+			}
+			article := tgbotapi.NewInlineQueryResultArticleHTML(strconv.Itoa(team.Id), team.Name, res)
+			article.Description = tr(lang, "team_inline_description", strings.Join(team.CardIds, " "))
+			answer.Results = append(answer.Results, article)
+		}
+	}
+	_, err := api.AnswerInlineQuery(answer)
+	return err
+}
@@ -4,10 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"html"
 	"log"
-	"os"
+	"net/http"
 	"regexp"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"time"
@@ -18,10 +19,7 @@ import (
 	"gopkg.in/telegram-bot-api.v4"
 )
 
-var config, _ = ini.Load("config.ini")
-var messageTemplate, _ = ioutil.ReadFile("message_template.html")
-var miniMessageTemplate, _ = ioutil.ReadFile("message_template_min.html")
-var helpTemplate, _ = ioutil.ReadFile("help_template.html")
+var config = loadConfig()
 var session = pg.Connect(&pg.Options{
 	User:     config.Section("database").Key("user").Value(),
 	Password: config.Section("database").Key("password").Value(),
@@ -29,12 +27,22 @@ var session = pg.Connect(&pg.Options{
 	Addr:     config.Section("database").Key("host").Value(),
 })
 
-var pollChan = make(chan *Poll)
+var pollEvents = make(chan pollEvent, 100)
+
+// loadConfig reads config.ini, without it the defaults are used, e.g. in tests
+func loadConfig() *ini.File {
+	cfg, err := ini.Load("config.ini")
+	if err != nil {
+		log.Printf("[Error] Can`t load config.ini: %v", err)
+		return ini.Empty()
+	}
+	return cfg
+}
 
 var client = redis.NewClient(&redis.Options{
-	Addr:     "localhost:6379",
-	Password: "", // no password set
-	DB:       0,  // use default DB
+	Addr:     config.Section("redis").Key("host").MustString("localhost:6379"),
+	Password: config.Section("redis").Key("password").Value(),
+	DB:       config.Section("redis").Key("db").MustInt(0),
 })
 
 var InlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
@@ -49,11 +57,13 @@ var InlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
 var re = regexp.MustCompile(`^/([a-zA-z]+)@tos_helper_bot\s*(.*)$`)
 var re2 = regexp.MustCompile(`^/([a-zA-z]+)\s*(.*)$`)
 
-const REDIS_DEFAULT_TIMEOUT = 0
 const CARD_DISPLAY_MODE_NORMAL = 1
 const CARD_DISPLAY_MODE_FULL = 2
 const POLL_DEFAULT_DURATION = time.Second * 60 * 60 * 24
 
+// longer messages are rejected by telegram
+const TELEGRAM_MESSAGE_LIMIT = 4096
+
 type Vote struct {
 	Id     int
 	PollId int
@@ -70,12 +80,16 @@ type Poll struct {
 	UserId      int
 	MessageId   int
 	ChatId      int64
+	Public      bool
+	Closed      bool
 }
 
 type PollUser struct {
-	PollId int
-	Poll   *Poll
-	UserId int
+	PollId   int
+	Poll     *Poll
+	UserId   int
+	VoteId   int
+	UserName string
 }
 
 type Skill struct {
@@ -108,6 +122,19 @@ type Card struct {
 	ActiveSkill   *Skill
 	LeaderSkillId int
 	LeaderSkill   *Skill
+	// Owned is set for cards in the box of the user who asked for the card
+	Owned bool `sql:"-"`
+}
+
+// dropMissingSkills turns skills left empty by the join into nil,
+// so a card without an active or leader skill is explicit for templates
+func (card *Card) dropMissingSkills() {
+	if card.ActiveSkill != nil && card.ActiveSkill.Id == 0 {
+		card.ActiveSkill = nil
+	}
+	if card.LeaderSkill != nil && card.LeaderSkill.Id == 0 {
+		card.LeaderSkill = nil
+	}
 }
 
 // func (card Card) String() string{
@@ -122,11 +149,13 @@ type Command struct {
 	reply_markup interface{}
 	tgRequest    *tgbotapi.Update
 	postData     string
+	language     string
 }
 
 type InlineQueryCard struct {
 	CardId string
 	Name   string
+	Owned  bool
 }
 
 type InlineQueryInfo struct {
@@ -147,13 +176,7 @@ func (command *Command) GetErrorMessage() error {
 }
 
 func (command *Command) NewMessage(text string) *tgbotapi.MessageConfig {
-	var chatId int64
-	if command.tgRequest.CallbackQuery != nil {
-		chatId = command.tgRequest.CallbackQuery.Message.Chat.ID
-	} else {
-		chatId = command.tgRequest.Message.Chat.ID
-	}
-	msg := tgbotapi.NewMessage(chatId, text)
+	msg := tgbotapi.NewMessage(command.chatId(), text)
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = command.GetReplyMarkup()
 	command.message = &msg
@@ -164,103 +187,98 @@ func (command *Command) EmptyMessage() *tgbotapi.MessageConfig {
 	return command.NewMessage("")
 }
 
-func (command *Command) ShowCardInfo(card *Card, display_mode int) *tgbotapi.MessageConfig {
-	var res string
-
+func (command *Command) ShowCardInfo(card *Card, display_mode int) (*tgbotapi.MessageConfig, error) {
+	name := TEMPLATE_CARD
 	if display_mode == CARD_DISPLAY_MODE_NORMAL {
-		res = fmt.Sprintf(string(miniMessageTemplate), card.Name,
-			card.Rarity, card.Attribute, card.Card_id, card.Cost, card.Race, card.Series,
-			card.MaxExp, card.PreviewLink, card.WikiLink, card.Name)
-	} else {
-		res = fmt.Sprintf(string(messageTemplate), card.Name, card.Attribute,
-			card.Card_id, card.Cost, card.Race, card.Series,
-			card.Rarity, card.MaxExp, card.Max_hp, card.Max_attk, card.Max_rec,
-			card.TotalStats, card.ActiveSkill.Lv1cd, card.ActiveSkill.Lvmaxcd, card.ActiveSkill.Name,
-			card.ActiveSkill.Effect, card.LeaderSkill.Name,
-			card.LeaderSkill.Effect, card.PreviewLink, card.WikiLink, card.Name)
+		name = TEMPLATE_CARD_MIN
 	}
-	fmt.Printf("Res is %q", res)
-	return command.NewMessage(res)
-
-}
+	owned, oerr := chatStore.OwnedCardIds(command.fromUser().ID, []string{card.Card_id})
+	if oerr != nil {
+		log.Printf("[Error] Can`t check the box of user %v: %v", command.fromUser().ID, oerr)
+	}
+	card.Owned = owned[card.Card_id]
+	res, err := renderTemplate(name, command.lang(), card)
+	if err != nil {
+		return nil, err
+	}
+	return command.NewMessage(res), nil
 
-func (command *Command) Help(api *tgbotapi.BotAPI) error {
-	msg := command.NewMessage(string(helpTemplate))
-	api.Send(msg)
-	return nil
 }
 
-func (command *Command) Report(api *tgbotapi.BotAPI, s string) error {
-	out, oerr := os.OpenFile("report.log", os.O_APPEND|os.O_WRONLY, 0600) //.Create("parsed.csv")
-	if oerr != nil {
-		return errors.New("Error while opening report file")
+func (command *Command) Help(api Sender) error {
+	res, err := renderTemplate(TEMPLATE_HELP, command.lang(), nil)
+	if err != nil {
+		return err
 	}
-	defer out.Close()
-	out.WriteString(s)
-	out.WriteString("\n")
-	return nil
+	return send(api, command.NewMessage(res))
 }
 
 func (command *Command) GetCardById(cardId string) (*Card, error) {
-	card := Card{}
-	err := session.Model(&card).Column("ActiveSkill", "LeaderSkill").
-		Where("card_id = ?", cardId).Limit(1).Select()
-	return &card, err
+	return cardStore.CardById(cardId)
 }
 
-func (command *Command) FindCardByID(api *tgbotapi.BotAPI, cardId string, display_mode int) error {
+func (command *Command) FindCardByID(api Sender, cardId string, display_mode int) error {
 	card, err := command.GetCardById(cardId)
 	if err != nil {
 		return err
 	}
-	msg := command.ShowCardInfo(card, display_mode)
-	api.Send(msg)
-	return nil
+	msg, serr := command.ShowCardInfo(card, display_mode)
+	if serr != nil {
+		return serr
+	}
+	return send(api, msg)
 
 }
 
-func (command *Command) FindCardByName(api *tgbotapi.BotAPI, name string, display_mode int) error {
-
-	var ConfirmRow = tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("✅ Ок", command.NewQuery("save")),
-		tgbotapi.NewInlineKeyboardButtonData("🚫 Отменить", command.NewQuery("cancel")),
-	)
-
+func (command *Command) FindCardByName(api Sender, name string, display_mode int) error {
 	if len(name) < 2 {
-		msg := command.NewMessage("Имя карты должно быть чуть длиннее 😔")
-		api.Send(msg)
-		return nil
+		msg := command.NewMessage(command.tr("card_name_too_short"))
+		return send(api, msg)
 	}
-	cards := make([]*Card, 3)
-	err := session.Model(&cards).Column("ActiveSkill", "LeaderSkill").
-		Where("card.name ilike ?", fmt.Sprintf("%%%v%%", name)).Order("card.rarity DESC").Limit(3).Select()
+	cards, err := cardStore.FindCards(name, 3)
 	if err != nil {
-		log.Printf("%q", err)
+		return err
 	}
-	fmt.Println(cards)
 	if len(cards) == 0 {
-		msg := command.NewMessage(fmt.Sprintf("Простите, мне не удалось найти такую карту 😢"))
-		api.Send(msg)
-		return nil
+		msg := command.NewMessage(command.tr("card_not_found"))
+		return send(api, msg)
 	} else if len(cards) == 1 {
-		msg := command.ShowCardInfo(cards[0], display_mode)
-		api.Send(msg)
-		return nil
+		msg, serr := command.ShowCardInfo(cards[0], display_mode)
+		if serr != nil {
+			return serr
+		}
+		return send(api, msg)
 	} else {
-		msg := command.ShowCardInfo(cards[0], display_mode)
+		msg, serr := command.ShowCardInfo(cards[0], display_mode)
+		if serr != nil {
+			return serr
+		}
 		markup := tgbotapi.NewInlineKeyboardMarkup()
 		ids := make([]InlineQueryCard, len(cards))
+		cardIds := make([]string, len(cards))
+		for i, v := range cards {
+			cardIds[i] = v.Card_id
+		}
+		owned, oerr := chatStore.OwnedCardIds(command.fromUser().ID, cardIds)
+		if oerr != nil {
+			log.Printf("[Error] Can`t check the box of user %v: %v", command.fromUser().ID, oerr)
+		}
 		for i, v := range cards {
-			ids[i] = InlineQueryCard{CardId: v.Card_id, Name: v.Name}
+			ids[i] = InlineQueryCard{CardId: v.Card_id, Name: v.Name, Owned: owned[v.Card_id]}
 			if i == 0 {
 				continue
 			}
-			row := tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(v.Name, command.NewQuery(v.Card_id)),
-			)
-			markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+			button, berr := command.queryButton(ownedLabel(v.Name, owned[v.Card_id]), v.Card_id)
+			if berr != nil {
+				return berr
+			}
+			markup.InlineKeyboard = append(markup.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(button))
+		}
+		confirmRow, cerr := command.confirmRow()
+		if cerr != nil {
+			return cerr
 		}
-		markup.InlineKeyboard = append(markup.InlineKeyboard, ConfirmRow)
+		markup.InlineKeyboard = append(markup.InlineKeyboard, confirmRow)
 		msg.ReplyMarkup = &markup
 		queryInfo := InlineQueryInfo{
 			UserId:      command.tgRequest.Message.From.ID,
@@ -269,19 +287,13 @@ func (command *Command) FindCardByName(api *tgbotapi.BotAPI, name string, displa
 		}
 		encoded, err := json.Marshal(queryInfo)
 		if err != nil {
-			fmt.Printf("Error while encoding: %v", err)
+			return err
 		}
-		fmt.Printf("\n LEn encoded: ", len(encoded))
-		//n := bytes.IndexByte(encoded, 0)
-		nencoded := string(encoded)
-		fmt.Printf("\n encoded: ")
-		fmt.Println(nencoded)
 		message, merr := api.Send(msg)
 		if merr != nil {
 			return merr
 		}
-		client.Set(strconv.Itoa(message.MessageID), nencoded, REDIS_DEFAULT_TIMEOUT)
-		return nil
+		return stateStore.SaveState(CALLBACK_STATE_FIND, message.Chat.ID, message.MessageID, string(encoded), callbackStateTimeout)
 	}
 	return command.GetErrorMessage()
 }
@@ -294,76 +306,355 @@ func (command *Command) GetReplyMarkup() interface{} {
 	return result
 }
 
-func (command *Command) NewQuery(data ...string) string {
-	pattern := strings.Repeat("%v:", len(data)+1)
-	new := make([]interface{}, len(data)+1)
-	new[0] = command.commWord
-	for i := 1; i < len(data)+1; i++ {
-		new[i] = data[i-1]
+// NewQuery builds signed callback data in the namespace of the command,
+// data longer than telegram accepts is an error
+func (command *Command) NewQuery(data ...string) (string, error) {
+	return encodeCallback(command.commWord, data...)
+}
+
+// queryButton returns a button sending the callback data of NewQuery
+func (command *Command) queryButton(label string, data ...string) (tgbotapi.InlineKeyboardButton, error) {
+	query, err := command.NewQuery(data...)
+	if err != nil {
+		return tgbotapi.InlineKeyboardButton{}, err
 	}
-	return fmt.Sprintf(pattern[:len(pattern)-1], new...)
+	return tgbotapi.NewInlineKeyboardButtonData(label, query), nil
 }
 
-func (command *Command) parseQuery(data string) ([]string, error) {
-	var emptyResult []string
-	result := strings.Split(data, ":")
-	if len(result) < 2 {
-		return emptyResult, errors.New("Wrong inline query")
+// confirmRow returns the buttons saving and cancelling the choice of a card
+func (command *Command) confirmRow() ([]tgbotapi.InlineKeyboardButton, error) {
+	save, err := command.queryButton(command.tr("button_ok"), "save")
+	if err != nil {
+		return nil, err
+	}
+	cancel, err := command.queryButton(command.tr("button_cancel"), "cancel")
+	if err != nil {
+		return nil, err
 	}
-	return result, nil
+	return tgbotapi.NewInlineKeyboardRow(save, cancel), nil
+}
+
+func (command *Command) parseQuery(data string) ([]string, error) {
+	return decodeCallback(data)
 }
 
 func (command *Command) postSave(message *tgbotapi.Message) {
 	if command.commWord == "find" || command.commWord == "f" {
-		client.Set(strconv.Itoa(message.MessageID), command.postData, REDIS_DEFAULT_TIMEOUT)
-		fmt.Printf("Set key %v into redis", message.MessageID)
+		err := stateStore.SaveState(CALLBACK_STATE_FIND, message.Chat.ID, message.MessageID, command.postData, callbackStateTimeout)
+		if err != nil {
+			log.Printf("[Error] Can`t save state of message %v: %v", message.MessageID, err)
+		}
 	}
 }
 
-func (command *Command) NewPoll(api *tgbotapi.BotAPI) error {
+// POLL_MAX_OPTIONS keeps the poll keyboard readable
+const POLL_MAX_OPTIONS = 10
+
+// polls about a replied message have no question of their own and are saved with this name
+const POLL_REPLY_NAME = "Poll 1"
+
+// pollHeader shows the question of a poll which is not about a replied message
+func pollHeader(poll *Poll) string {
+	if poll.Name == POLL_REPLY_NAME {
+		return ""
+	}
+	return "<b>" + html.EscapeString(poll.Name) + "</b>\n\n"
+}
+
+// NewPoll votes on the replied message, without a reply the question and the options are asked
+func (command *Command) NewPoll(api Sender) error {
+	public := len(command.commParams) > 0 && command.commParams[0] == "public"
 	if command.tgRequest.Message.ReplyToMessage == nil {
-		api.Send(command.NewMessage("Вы не указали сообщение для голосования 😔"))
-		return nil
+		params := ""
+		if public {
+			params = "public"
+		}
+		return command.startConversation(api, "poll", params)
+	}
+	options := []string{command.tr("poll_vote_for"), command.tr("poll_vote_against")}
+	return command.createPoll(api, POLL_REPLY_NAME, options, public, command.tgRequest.Message.ReplyToMessage.MessageID)
+}
+
+// pollFlow asks for the question and the options of a poll which is not about a message
+var pollFlow = &conversationFlow{
+	steps: []conversationStep{
+		{ask("poll_ask_question"), checkAnything},
+		{ask("poll_ask_options"), checkPollOptions},
+	},
+	finish: func(command *Command, api Sender, params string, answers []string) error {
+		var options []string
+		if answers[1] == "-" {
+			options = []string{command.tr("poll_vote_for"), command.tr("poll_vote_against")}
+		} else {
+			options = strings.Split(answers[1], "\n")
+		}
+		return command.createPoll(api, answers[0], options, params == "public", 0)
+	},
+}
+
+// checkPollOptions accepts options separated by commas or new lines, "-" means for/against
+func checkPollOptions(command *Command, answer string) (string, string, error) {
+	if answer == "-" {
+		return answer, "", nil
 	}
+	var options []string
+	for _, option := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+	if len(options) < 2 || len(options) > POLL_MAX_OPTIONS {
+		return "", command.tr("poll_options_count", POLL_MAX_OPTIONS), nil
+	}
+	return strings.Join(options, "\n"), "", nil
+}
 
+// createPoll saves the poll with its options and sends the keyboard,
+// replyTo is the message the poll is about
+func (command *Command) createPoll(api Sender, name string, options []string, public bool, replyTo int) error {
 	poll := Poll{
-		Name:        "Poll 1",
+		Name:        name,
 		Created:     time.Now(),
 		ActiveUntil: time.Now().Add(POLL_DEFAULT_DURATION),
 		UserId:      command.tgRequest.Message.From.ID,
 		ChatId:      command.tgRequest.Message.Chat.ID,
+		Public:      public,
 	}
-	err := session.Insert(&poll)
+	votes, err := pollStore.CreatePoll(&poll, options)
 	if err != nil {
 		return err
 	}
-	vote1 := Vote{Name: "👍 За", PollId: poll.Id}
-	vote2 := Vote{Name: "👎 Против", PollId: poll.Id}
-	_, verr := session.Model(&vote1, &vote2).Insert()
-	if verr != nil {
-		return verr
-	}
 
-	msg := command.NewMessage("Выберите 1 из вариантов:")
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData(
-			fmt.Sprintf("%v (0)", vote1.Name),
-			command.NewQuery(strconv.Itoa(poll.Id), strconv.Itoa(vote1.Id))),
-		tgbotapi.NewInlineKeyboardButtonData(
-			fmt.Sprintf("%v (0)", vote2.Name),
-			command.NewQuery(strconv.Itoa(poll.Id), strconv.Itoa(vote2.Id)),
-		)))
-	msg.ReplyToMessageID = command.tgRequest.Message.ReplyToMessage.MessageID
-	message, _ := api.Send(msg)
+	text := command.tr("poll_choose")
+	if poll.Public {
+		text = command.tr("poll_choose_public")
+	}
+	markup, kerr := command.pollKeyboard(&poll, votes)
+	if kerr != nil {
+		return kerr
+	}
+	msg := command.NewMessage(pollHeader(&poll) + text)
+	msg.ReplyMarkup = markup
+	msg.ReplyToMessageID = replyTo
+	message, serr := api.Send(msg)
+	if serr != nil {
+		return serr
+	}
 	poll.MessageId = message.MessageID
-	_, qerr := session.Model(&poll).Set("message_id = ?message_id").Update()
+	qerr := pollStore.SetPollMessage(&poll)
 	if qerr == nil {
-		pollChan <- &poll
+		pollEvents <- pollEvent{Type: POLL_EVENT_CREATED, PollId: poll.Id, Poll: &poll}
 	}
 	return qerr
 }
 
-func (command *Command) Run(api *tgbotapi.BotAPI) error {
+func (command *Command) pollKeyboard(poll *Poll, votes []Vote) (tgbotapi.InlineKeyboardMarkup, error) {
+	// an option per row, so long options are readable and the number of buttons in a row is not exceeded
+	markup := tgbotapi.NewInlineKeyboardMarkup()
+	pollId := strconv.Itoa(poll.Id)
+	for _, vote := range votes {
+		button, err := command.queryButton(fmt.Sprintf("%v (%v)", vote.Name, vote.Count), pollId, strconv.Itoa(vote.Id))
+		if err != nil {
+			return markup, err
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(button))
+	}
+	// the keyboard is also rebuilt by the poll watcher, which has no request to take the language from
+	lang := chatLanguageOrDefault(poll.ChatId)
+	closeButton, err := command.queryButton(tr(lang, "poll_button_close"), pollId, "close")
+	if err != nil {
+		return markup, err
+	}
+	controls := tgbotapi.NewInlineKeyboardRow(closeButton)
+	if poll.Public {
+		votersButton, verr := command.queryButton(tr(lang, "poll_button_voters"), pollId, "voters")
+		if verr != nil {
+			return markup, verr
+		}
+		controls = append(controls, votersButton)
+	}
+	markup.InlineKeyboard = append(markup.InlineKeyboard, controls)
+	return markup, nil
+}
+
+// formatPollResults builds the final summary shown instead of the poll keyboard
+func formatPollResults(lang string, poll *Poll, votes []Vote, voters []PollUser) string {
+	var b strings.Builder
+	total := 0
+	for _, vote := range votes {
+		total += vote.Count
+	}
+	b.WriteString(pollHeader(poll) + tr(lang, "poll_closed_title") + "\n\n")
+	var winner *Vote
+	tie := false
+	for i, vote := range votes {
+		percent := 0
+		if total > 0 {
+			percent = vote.Count * 100 / total
+		}
+		fmt.Fprintf(&b, "%v — %v (%v%%)\n", html.EscapeString(vote.Name), vote.Count, percent)
+		switch {
+		case winner == nil || vote.Count > winner.Count:
+			winner = &votes[i]
+			tie = false
+		case vote.Count == winner.Count:
+			tie = true
+		}
+	}
+	b.WriteString("\n" + tr(lang, "poll_total", total) + "\n")
+	switch {
+	case total == 0:
+		b.WriteString(tr(lang, "poll_no_votes"))
+	case tie:
+		b.WriteString(tr(lang, "poll_tie"))
+	default:
+		b.WriteString(tr(lang, "poll_winner", html.EscapeString(winner.Name)))
+	}
+	if poll.Public && total > 0 {
+		b.WriteString("\n\n" + formatPollVoters(votes, voters))
+	}
+	return b.String()
+}
+
+// pollMessageGone reports edit errors which won't go away on retry,
+// the poll is closed anyway when they happen
+func pollMessageGone(err error) bool {
+	text := err.Error()
+	return strings.Contains(text, "message is not modified") ||
+		strings.Contains(text, "message to edit not found") ||
+		strings.Contains(text, "message can't be edited")
+}
+
+// closePoll replaces the keyboard of the poll with the final results and then marks the poll
+// as closed. When the edit fails the poll stays open, so closing can be retried.
+func (command *Command) closePoll(api Sender, poll *Poll) error {
+	pollEdits.Lock()
+	defer pollEdits.Unlock()
+	var voters []PollUser
+	votes, verr := voteStore.PollVotes(poll.Id)
+	if verr != nil {
+		return verr
+	}
+	if poll.Public {
+		var uerr error
+		voters, uerr = voteStore.PollVoters(poll.Id)
+		if uerr != nil {
+			return uerr
+		}
+	}
+	msg := tgbotapi.NewEditMessageText(poll.ChatId, poll.MessageId, formatPollResults(chatLanguageOrDefault(poll.ChatId), poll, votes, voters))
+	msg.ParseMode = "HTML"
+	_, serr := api.Send(msg)
+	if serr != nil && !pollMessageGone(serr) {
+		return serr
+	}
+	_, err := pollStore.ClosePoll(poll)
+	return err
+}
+
+func (command *Command) ClosePoll(api Sender) error {
+	message := command.tgRequest.Message
+	if message.ReplyToMessage == nil {
+		return send(api, command.NewMessage(command.tr("poll_not_reply")))
+	}
+	poll, err := pollStore.PollByMessage(message.Chat.ID, message.ReplyToMessage.MessageID)
+	if err == pg.ErrNoRows {
+		return send(api, command.NewMessage(command.tr("poll_not_poll")))
+	} else if err != nil {
+		return err
+	}
+	if poll.UserId != message.From.ID && !command.hasPermission(api, PERMISSION_CHAT_ADMIN) {
+		return send(api, command.NewMessage(command.tr("poll_close_forbidden")))
+	}
+	if poll.Closed {
+		return send(api, command.NewMessage(command.tr("poll_already_closed")))
+	}
+	cerr := command.closePoll(api, poll)
+	if cerr == nil {
+		pollEvents <- pollEvent{Type: POLL_EVENT_CLOSED, PollId: poll.Id}
+	}
+	return cerr
+}
+
+// formatPollVoters lists voters of a public poll grouped by the option they chose
+func formatPollVoters(votes []Vote, voters []PollUser) string {
+	var b strings.Builder
+	for _, vote := range votes {
+		names := make([]string, 0)
+		for _, voter := range voters {
+			if voter.VoteId == vote.Id {
+				names = append(names, html.EscapeString(voter.UserName))
+			}
+		}
+		fmt.Fprintf(&b, "<b>%v</b> (%v):\n", html.EscapeString(vote.Name), len(names))
+		if len(names) == 0 {
+			b.WriteString("—\n\n")
+		} else {
+			b.WriteString(strings.Join(names, ", ") + "\n\n")
+		}
+	}
+	return b.String()
+}
+
+// telegram doesn't show longer alerts
+const CALLBACK_ALERT_LIMIT = 200
+
+// formatPollVotersAlert is formatPollVoters in plain text after the title, cut to fit an alert
+func formatPollVotersAlert(title string, votes []Vote, voters []PollUser) string {
+	var b strings.Builder
+	b.WriteString(title + "\n")
+	for _, vote := range votes {
+		names := make([]string, 0)
+		for _, voter := range voters {
+			if voter.VoteId == vote.Id {
+				names = append(names, voter.UserName)
+			}
+		}
+		list := strings.Join(names, ", ")
+		if len(names) == 0 {
+			list = "—"
+		}
+		fmt.Fprintf(&b, "%v (%v): %v\n", vote.Name, len(names), list)
+	}
+	text := []rune(strings.TrimSpace(b.String()))
+	if len(text) > CALLBACK_ALERT_LIMIT {
+		text = append(text[:CALLBACK_ALERT_LIMIT-1], '…')
+	}
+	return string(text)
+}
+
+func (command *Command) showPollVoters(api Sender, query *tgbotapi.CallbackQuery, pollId int) error {
+	poll, err := pollStore.PollById(pollId)
+	if err != nil {
+		return err
+	}
+	if !poll.Public {
+		answerCallback(api, query.ID, command.tr("poll_anonymous"))
+		return nil
+	}
+	votes, verr := voteStore.PollVotes(pollId)
+	if verr != nil {
+		return verr
+	}
+	voters, uerr := voteStore.PollVoters(pollId)
+	if uerr != nil {
+		return uerr
+	}
+	// an alert is seen only by the user who asked, so clicks don't flood the chat
+	_, aerr := api.AnswerCallbackQuery(tgbotapi.NewCallbackWithAlert(query.ID, formatPollVotersAlert(command.tr("poll_results"), votes, voters)))
+	return aerr
+}
+
+// userDisplayName returns the name shown for a user in public poll results
+func userDisplayName(user *tgbotapi.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = "@" + user.UserName
+	}
+	return name
+}
+
+func (command *Command) Run(api Sender) error {
 
 	if !command.IsValid() {
 		return command.GetErrorMessage()
@@ -378,6 +669,12 @@ func (command *Command) Run(api *tgbotapi.BotAPI) error {
 	if len(matches) == 3 {
 		command.commParams = matches[2:]
 	}
+	if isBanned(command.fromUser().ID) {
+		return nil
+	}
+	if !command.hasPermission(api, commandPermissions[command.commWord]) {
+		return send(api, command.NewMessage(command.tr("no_permission_command")))
+	}
 	switch {
 	case command.commWord == "show" && command.commParams[0] != "":
 		return command.FindCardByID(api, command.commParams[0], CARD_DISPLAY_MODE_FULL)
@@ -387,16 +684,66 @@ func (command *Command) Run(api *tgbotapi.BotAPI) error {
 		return command.Help(api)
 	case command.commWord == "report" && command.commParams[0] != "":
 		return command.Report(api, command.commParams[0])
+	case command.commWord == "reports":
+		return command.ListReports(api)
+	case command.commWord == "resolve" && command.commParams[0] != "":
+		return command.ResolveReport(api, command.commParams[0])
 	case (command.commWord == "find" || command.commWord == "f") && command.commParams[0] != "":
 		return command.FindCardByName(api, command.commParams[0], CARD_DISPLAY_MODE_NORMAL)
 	case command.commWord == "poll":
 		return command.NewPoll(api)
+	case command.commWord == "closepoll":
+		return command.ClosePoll(api)
+	case command.commWord == "remind":
+		return command.Remind(api, command.commParams[0])
+	case command.commWord == "announce":
+		return command.Announce(api, command.commParams[0])
+	case command.commWord == "reminders":
+		return command.ListReminders(api)
+	case command.commWord == "unremind":
+		return command.DeleteReminder(api, command.commParams[0])
+	case command.commWord == "reload":
+		return command.ReloadTemplates(api)
+	case command.commWord == "import":
+		return command.ImportCatalog(api)
+	case command.commWord == "stats":
+		return command.Stats(api)
+	case command.commWord == "ban":
+		return command.Ban(api, command.commParams[0])
+	case command.commWord == "unban":
+		return command.Unban(api, command.commParams[0])
+	case command.commWord == "lang":
+		return command.SetLanguage(api, command.commParams[0])
+	case command.commWord == "fix":
+		return command.ProposeFix(api, command.commParams[0])
+	case command.commWord == "compare":
+		return command.Compare(api, command.commParams[0])
+	case command.commWord == "team":
+		return command.Team(api, command.commParams[0])
+	case command.commWord == "teams":
+		return command.ListTeams(api)
+	case command.commWord == "dmg":
+		return command.Damage(api, command.commParams[0])
+	case command.commWord == "own":
+		return command.Own(api, command.commParams[0])
+	case command.commWord == "box":
+		return command.Box(api)
+	case command.commWord == "whohas":
+		return command.WhoHas(api, command.commParams[0])
+	case command.commWord == "roster":
+		return command.Roster(api)
+	case command.commWord == "stage":
+		return command.ShowStage(api, command.commParams[0])
+	case command.commWord == "counter":
+		return command.Counter(api, command.commParams[0])
+	case command.commWord == "cancel" || command.commWord == "back":
+		return command.NoConversation(api)
 	default:
 		return command.GetErrorMessage()
 	}
 }
 
-func (command *Command) applyCallbackQuery(api *tgbotapi.BotAPI) error {
+func (command *Command) applyCallbackQuery(api Sender) error {
 	var rdata InlineQueryInfo
 	comm := Command{}
 	query := command.tgRequest.CallbackQuery
@@ -405,35 +752,43 @@ func (command *Command) applyCallbackQuery(api *tgbotapi.BotAPI) error {
 
 	dArr, dErr := comm.parseQuery(query.Data)
 	if dErr != nil {
+		answerCallback(api, query.ID, command.tr("callback_invalid"))
 		return dErr
 	}
 
 	commandWord, queryData := dArr[0], dArr[1]
 	command.commWord = commandWord
+	if isBanned(query.From.ID) {
+		answerCallback(api, query.ID, "")
+		return nil
+	}
+	if !command.hasPermission(api, callbackPermissions[commandWord]) {
+		answerCallback(api, query.ID, command.tr("no_permission_action"))
+		return nil
+	}
 	switch {
 	case queryData == "save" && (commandWord == "f" || commandWord == "find"):
-
-		fmt.Println(query.Message.Text)
 		msg := tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, tgbotapi.InlineKeyboardMarkup{kbd})
 		//msg.ParseMode = "HTML"
-		api.Send(msg)
-		return nil
+		return send(api, msg)
 	case queryData == "cancel" && (commandWord == "f" || commandWord == "find"):
-		api.Send(tgbotapi.DeleteMessageConfig{
+		return send(api, tgbotapi.DeleteMessageConfig{
 			ChatID:    query.Message.Chat.ID,
 			MessageID: query.Message.MessageID,
 		})
-		return nil
 	case commandWord == "f" || commandWord == "find":
-		data, err := client.Get(strconv.Itoa(query.Message.MessageID)).Result()
-		if err == redis.Nil {
-			return errors.New("redis key not found")
-		} else if err != nil {
-			return errors.New("Unknown redis error")
+		data, found, err := stateStore.LoadState(CALLBACK_STATE_FIND, query.Message.Chat.ID, query.Message.MessageID)
+		if err != nil {
+			answerCallback(api, query.ID, command.tr("service_unavailable"))
+			return err
+		}
+		if !found {
+			answerCallback(api, query.ID, command.tr("callback_expired"))
+			return nil
 		}
 		json.Unmarshal([]byte(data), &rdata)
 		if rdata.UserId != query.From.ID {
-			api.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "У вас нет прав для этого действия"))
+			answerCallback(api, query.ID, command.tr("no_permission_action"))
 			return nil
 		}
 		msg, err := command.queryCardId(
@@ -444,145 +799,184 @@ func (command *Command) applyCallbackQuery(api *tgbotapi.BotAPI) error {
 		if err != nil {
 			return err
 		}
-		api.Send(msg)
-		return nil
+		return send(api, msg)
+	case commandWord == "fix" && len(dArr) == 3:
+		fixId, _ := strconv.Atoi(dArr[1])
+		return command.reviewFix(api, query, fixId, dArr[2])
+	case commandWord == "poll" && len(dArr) == 3 && dArr[2] == "voters":
+		pollId, _ := strconv.Atoi(dArr[1])
+		return command.showPollVoters(api, query, pollId)
+	case commandWord == "poll" && len(dArr) == 3 && dArr[2] == "close":
+		pollId, _ := strconv.Atoi(dArr[1])
+		poll, err := pollStore.PollById(pollId)
+		if err != nil {
+			return err
+		}
+		if poll.UserId != query.From.ID && !command.hasPermission(api, PERMISSION_CHAT_ADMIN) {
+			answerCallback(api, query.ID, command.tr("poll_close_forbidden"))
+			return nil
+		}
+		if poll.Closed {
+			answerCallback(api, query.ID, command.tr("poll_already_closed"))
+			return nil
+		}
+		answerCallback(api, query.ID, command.tr("poll_closed"))
+		cerr := command.closePoll(api, poll)
+		if cerr == nil {
+			pollEvents <- pollEvent{Type: POLL_EVENT_CLOSED, PollId: poll.Id}
+		}
+		return cerr
 	case commandWord == "poll" && len(dArr) == 3:
 		voteId, _ := strconv.Atoi(dArr[2])
 		pollId, _ := strconv.Atoi(dArr[1])
 
-		count, _ := session.Model(&PollUser{}).Where("user_id = ? and poll_id = ?", query.From.ID, pollId).Count()
-		if count > 0 {
-			api.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Вы уже голосовали в этом опросе"))
+		poll, perr := pollStore.PollById(pollId)
+		if perr != nil {
+			return perr
+		}
+		if poll.Closed || poll.ActiveUntil.Before(time.Now()) {
+			answerCallback(api, query.ID, command.tr("poll_already_closed"))
 			return nil
 		}
 
-		poll := Poll{Id: pollId}
-		vote := Vote{Id: voteId}
-		err := session.Select(&vote)
+		vote, err := voteStore.VoteById(voteId)
 		if err != nil {
 			return err
 		}
-		_, ierr := session.Model(&PollUser{PollId: pollId, UserId: query.From.ID}).Insert()
+		if vote.PollId != pollId {
+			return errors.New("Vote does not belong to poll")
+		}
+		voted, ierr := voteStore.RecordVote(&PollUser{
+			PollId:   pollId,
+			UserId:   query.From.ID,
+			VoteId:   voteId,
+			UserName: userDisplayName(query.From),
+		})
 		if ierr != nil {
-			api.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Ошибка. Сервис недоступен"))
+			answerCallback(api, query.ID, command.tr("service_unavailable"))
 			return ierr
 		}
-		session.Model(&vote).Set("count = count + 1").Update()
-		session.Model(&poll).Set("modified = true").Update()
-		api.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Спасибо, ваш голос учтен"))
+		if !voted {
+			answerCallback(api, query.ID, command.tr("poll_already_voted"))
+			return nil
+		}
+		// a busy watcher must not hold up the worker, the next vote refreshes the poll anyway
+		select {
+		case pollEvents <- pollEvent{Type: POLL_EVENT_VOTED, PollId: pollId}:
+		default:
+			log.Printf("[Error] Can`t report the vote in poll %v, the poll watcher is busy", pollId)
+		}
+		answerCallback(api, query.ID, command.tr("poll_vote_accepted"))
 		return nil
 	}
 	return nil
 }
 
 func (command *Command) queryCardId(cardId string, query *tgbotapi.CallbackQuery, rdata *InlineQueryInfo) (*tgbotapi.EditMessageTextConfig, error) {
-	var ConfirmRow = tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("✅ Ок", command.NewQuery("save")),
-		tgbotapi.NewInlineKeyboardButtonData("🚫 Отменить", command.NewQuery("cancel")),
-	)
-
 	var EmptyResult tgbotapi.EditMessageTextConfig
-	fmt.Printf("Card id is %q \n", cardId)
 	card, err := command.GetCardById(cardId)
 	if err != nil {
 		return &EmptyResult, err
 	}
-	cardInfo := command.ShowCardInfo(card, CARD_DISPLAY_MODE_NORMAL)
+	cardInfo, serr := command.ShowCardInfo(card, CARD_DISPLAY_MODE_NORMAL)
+	if serr != nil {
+		return &EmptyResult, serr
+	}
 	msg := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, cardInfo.Text)
 	markup := tgbotapi.NewInlineKeyboardMarkup()
 	for _, v := range rdata.CardsList {
 		if v.CardId == cardId {
 			continue
 		}
-		row := tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(v.Name, command.NewQuery(v.CardId)),
-		)
-		markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+		button, berr := command.queryButton(ownedLabel(v.Name, v.Owned), v.CardId)
+		if berr != nil {
+			return &EmptyResult, berr
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(button))
 	}
-	markup.InlineKeyboard = append(markup.InlineKeyboard, ConfirmRow)
+	confirmRow, cerr := command.confirmRow()
+	if cerr != nil {
+		return &EmptyResult, cerr
+	}
+	markup.InlineKeyboard = append(markup.InlineKeyboard, confirmRow)
 	msg.ReplyMarkup = &markup
 	msg.ParseMode = "HTML"
 	return &msg, nil
 }
 
-func watchActivePolls(api *tgbotapi.BotAPI, c chan *Poll) {
-	var polls []*Poll
-	var votes []Vote
-	command := Command{commWord: "poll"}
-	err := session.Model(&polls).Where("active_until > ?", time.Now().Format(time.RFC3339)).Select()
-	if err != nil {
-		fmt.Printf("%v", err)
-	}
-	for {
-		actualPolls := make([]*Poll, 0)
-		select {
-		case newPoll := <-c:
-			polls = append(polls, newPoll)
-		default:
-			for _, poll := range polls {
-				if poll.ActiveUntil.Before(time.Now()) {
-					continue
-				}
-				actualPolls = append(actualPolls, poll)
-				err := session.Model(&votes).Column("Poll").Where("poll_id = ? and poll.modified=true", poll.Id).Order("id").Select()
-				if err != nil {
-					fmt.Println(err)
-					continue
-				}
-				if len(votes) == 0 {
-					continue
-				}
-				buttons := make([]tgbotapi.InlineKeyboardButton, len(votes))
-				for i, vote := range votes {
-					buttons[i] = tgbotapi.NewInlineKeyboardButtonData(
-						fmt.Sprintf("%v (%v)", vote.Name, vote.Count),
-						command.NewQuery(strconv.Itoa(poll.Id), strconv.Itoa(vote.Id)),
-					)
-				}
-				msg := tgbotapi.NewEditMessageReplyMarkup(poll.ChatId, poll.MessageId, tgbotapi.NewInlineKeyboardMarkup(buttons))
-				api.Send(msg)
-				_, uerr := session.Model(poll).Set("modified = false").Update()
-				if uerr != nil {
-					fmt.Println(uerr)
-				}
-			}
-			polls = actualPolls
-			time.Sleep(2 * time.Second)
+// handleUpdate runs a single message or callback, a panic is logged
+// and the bot keeps serving other updates
+func handleUpdate(bot Sender, update tgbotapi.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Error] Panic while handling update %v: %v\n%s", update.UpdateID, r, debug.Stack())
+		}
+	}()
+	log.Printf("-----------------\n")
+	if update.Message != nil {
+		trackChatMember(update.Message)
+		log.Printf("[%s] %q in chat %v", update.Message.From.UserName, update.Message.Text, update.Message.Chat.ID)
+		command := Command{raw_text: update.Message.Text, tgRequest: &update}
+		answered, err := command.continueConversation(bot)
+		if !answered {
+			err = command.Run(bot)
+		}
+		if err != nil {
+			log.Printf("[Error] Can`t handle message %v: %v", update.Message.MessageID, err)
+		}
+	} else if update.CallbackQuery != nil {
+		command := Command{tgRequest: &update}
+		err := command.applyCallbackQuery(bot)
+		if err != nil {
+			log.Printf("[Error] Can`t handle callback query %v: %v", update.CallbackQuery.ID, err)
+		}
+
+	} else if update.InlineQuery != nil {
+		err := answerTeamQuery(bot, update.InlineQuery)
+		if err != nil {
+			log.Printf("[Error] Can`t answer inline query: %v", err)
 		}
 	}
 }
 
 func main() {
 	token := config.Section("telegram").Key("token").Value()
-	bot, err := tgbotapi.NewBotAPI(token)
+	bot, err := newBotAPI(token, config.Section("telegram").Key("api_url").Value(), &http.Client{})
 	if err != nil {
 		log.Panic(err)
 	}
-	bot.Debug = true
+	bot.Debug = config.Section("telegram").Key("debug").MustBool(false)
 
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout, _ = strconv.Atoi(config.Section("telegram").Key("timeout").Value())
-	updates, err := bot.GetUpdatesChan(u)
-	go watchActivePolls(bot, pollChan)
-	for update := range updates {
-		log.Printf("-----------------\n")
-		if update.Message != nil {
-
-			log.Printf("[%s] %q", update.Message.From.UserName, update.Message.Text, update.Message.Chat.ID)
-			command := Command{raw_text: update.Message.Text, tgRequest: &update}
-			err := command.Run(bot)
-			if err != nil {
-				fmt.Println(err)
-			}
-		} else if update.CallbackQuery != nil {
-			command := Command{tgRequest: &update}
-			err := command.applyCallbackQuery(bot)
-			if err != nil {
-				fmt.Printf("Error: %v", err)
-			}
-
-		}
+	var updates tgbotapi.UpdatesChannel
+	var server *http.Server
+	if webhookEnabled() {
+		updates, server, err = listenWebhook(bot)
+	} else {
+		// getUpdates doesn't work while a webhook is set
+		bot.RemoveWebhook()
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout, _ = strconv.Atoi(config.Section("telegram").Key("timeout").Value())
+		updates, err = bot.GetUpdatesChan(u)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	if terr := loadTemplates(); terr != nil {
+		log.Panic(terr)
+	}
+	if merr := migrateSchema(); merr != nil {
+		log.Panic(merr)
+	}
+	if berr := loadBans(); berr != nil {
+		log.Panic(berr)
 	}
+	go watchActivePolls(bot, pollEvents)
+	go watchReminders(bot)
+	go watchTemplates()
+	dispatcher := newUpdateDispatcher(bot)
+	dispatcher.run(updates, stopOnSignal(bot, server))
+	dispatcher.stop()
+	log.Printf("Stopped")
 }
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const TEST_GROUP_ID = -100
+const TEST_USER_ID = 1
+const TEST_OTHER_USER_ID = 2
+
+func TestMain(m *testing.M) {
+	if err := loadTemplates(); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeSender records what handlers send, messages get increasing ids
+type fakeSender struct {
+	mx      sync.Mutex
+	sent    []tgbotapi.Chattable
+	answers []tgbotapi.CallbackConfig
+	lastId  int
+}
+
+func (api *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	api.mx.Lock()
+	defer api.mx.Unlock()
+	api.sent = append(api.sent, c)
+	api.lastId++
+	message := tgbotapi.Message{MessageID: api.lastId}
+	if msg, ok := c.(*tgbotapi.MessageConfig); ok {
+		message.Chat = &tgbotapi.Chat{ID: msg.ChatID}
+		message.Text = msg.Text
+	}
+	return message, nil
+}
+
+func (api *fakeSender) AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error) {
+	api.mx.Lock()
+	defer api.mx.Unlock()
+	api.answers = append(api.answers, config)
+	return tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (api *fakeSender) AnswerInlineQuery(config tgbotapi.InlineConfig) (tgbotapi.APIResponse, error) {
+	return tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (api *fakeSender) GetChatAdministrators(config tgbotapi.ChatConfig) ([]tgbotapi.ChatMember, error) {
+	return nil, nil
+}
+
+func (api *fakeSender) lastSent(t *testing.T) tgbotapi.Chattable {
+	t.Helper()
+	if len(api.sent) == 0 {
+		t.Fatal("nothing was sent")
+	}
+	return api.sent[len(api.sent)-1]
+}
+
+func (api *fakeSender) lastAnswer(t *testing.T) string {
+	t.Helper()
+	if len(api.answers) == 0 {
+		t.Fatal("the callback was not answered")
+	}
+	return api.answers[len(api.answers)-1].Text
+}
+
+// useMemoryStore makes handlers use a memory store for the test
+func useMemoryStore(t *testing.T, cards ...*Card) *memoryStore {
+	store := newMemoryStore(cards...)
+	oldCards, oldChats, oldPolls, oldVotes, oldStates := cardStore, chatStore, pollStore, voteStore, stateStore
+	cardStore, chatStore, pollStore, voteStore, stateStore = store, store, store, store, store
+	chatLanguages.mx.Lock()
+	chatLanguages.value = make(map[int64]string)
+	chatLanguages.mx.Unlock()
+	t.Cleanup(func() {
+		cardStore, chatStore, pollStore, voteStore, stateStore = oldCards, oldChats, oldPolls, oldVotes, oldStates
+		// nobody watches polls in tests
+		for {
+			select {
+			case <-pollEvents:
+			default:
+				return
+			}
+		}
+	})
+	return store
+}
+
+func testMessage(chatId int64, userId int, text string) *tgbotapi.Message {
+	chatType := "group"
+	if chatId > 0 {
+		chatType = "private"
+	}
+	return &tgbotapi.Message{
+		MessageID: 1000,
+		From:      &tgbotapi.User{ID: userId, FirstName: "User", LastName: strings.Repeat("I", userId)},
+		Chat:      &tgbotapi.Chat{ID: chatId, Type: chatType},
+		Text:      text,
+	}
+}
+
+func runMessage(api Sender, message *tgbotapi.Message) error {
+	update := tgbotapi.Update{Message: message}
+	command := Command{raw_text: message.Text, tgRequest: &update}
+	answered, err := command.continueConversation(api)
+	if !answered {
+		err = command.Run(api)
+	}
+	return err
+}
+
+func runCallback(api Sender, chatId int64, messageId int, userId int, data string) error {
+	message := testMessage(chatId, userId, "")
+	message.MessageID = messageId
+	update := tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "query",
+		From:    message.From,
+		Message: message,
+		Data:    data,
+	}}
+	command := Command{tgRequest: &update}
+	return command.applyCallbackQuery(api)
+}
+
+// buttonData returns the callback data of the button with the text starting with the label
+func buttonData(t *testing.T, markup interface{}, label string) string {
+	t.Helper()
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	switch m := markup.(type) {
+	case tgbotapi.InlineKeyboardMarkup:
+		keyboard = m
+	case *tgbotapi.InlineKeyboardMarkup:
+		keyboard = *m
+	default:
+		t.Fatalf("no inline keyboard in %T", markup)
+	}
+	for _, row := range keyboard.InlineKeyboard {
+		for _, button := range row {
+			if strings.HasPrefix(button.Text, label) && button.CallbackData != nil {
+				return *button.CallbackData
+			}
+		}
+	}
+	t.Fatalf("no button %q", label)
+	return ""
+}
+
+func testCards() []*Card {
+	return []*Card{
+		{Card_id: "1", Name: "Water Dragon", Attribute: "Water", Rarity: 5},
+		{Card_id: "2", Name: "Fire Dragon", Attribute: "Fire", Rarity: 6},
+		{Card_id: "3", Name: "Earth Golem", Attribute: "Earth", Rarity: 4},
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	useMemoryStore(t)
+	api := &fakeSender{}
+	if err := runMessage(api, testMessage(TEST_GROUP_ID, TEST_USER_ID, "hello")); err == nil {
+		t.Error("a message without a command is not an error")
+	}
+	if err := runMessage(api, testMessage(TEST_GROUP_ID, TEST_USER_ID, "/nosuchcommand")); err == nil {
+		t.Error("an unknown command is not an error")
+	}
+	if len(api.sent) != 0 {
+		t.Errorf("sent %v messages, want none", len(api.sent))
+	}
+}
+
+func TestRunBannedUser(t *testing.T) {
+	useMemoryStore(t, testCards()...)
+	bannedUsers.mx.Lock()
+	bannedUsers.value[TEST_OTHER_USER_ID] = true
+	bannedUsers.mx.Unlock()
+	defer func() {
+		bannedUsers.mx.Lock()
+		delete(bannedUsers.value, TEST_OTHER_USER_ID)
+		bannedUsers.mx.Unlock()
+	}()
+	api := &fakeSender{}
+	if err := runMessage(api, testMessage(TEST_GROUP_ID, TEST_OTHER_USER_ID, "/s 1")); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.sent) != 0 {
+		t.Errorf("sent %v messages to a banned user, want none", len(api.sent))
+	}
+}
+
+func TestRunPermission(t *testing.T) {
+	useMemoryStore(t)
+	api := &fakeSender{}
+	if err := runMessage(api, testMessage(TEST_GROUP_ID, TEST_USER_ID, "/ban 5")); err != nil {
+		t.Fatal(err)
+	}
+	msg := api.lastSent(t).(*tgbotapi.MessageConfig)
+	if msg.Text != tr(DEFAULT_LANGUAGE, "no_permission_command") {
+		t.Errorf("answer to /ban of a user = %q", msg.Text)
+	}
+}
+
+func TestRunLanguage(t *testing.T) {
+	store := useMemoryStore(t)
+	api := &fakeSender{}
+	// the user is the admin of a private chat
+	if err := runMessage(api, testMessage(TEST_USER_ID, TEST_USER_ID, "/lang en")); err != nil {
+		t.Fatal(err)
+	}
+	if lang, _ := store.ChatLanguage(TEST_USER_ID); lang != "en" {
+		t.Errorf("saved language = %q, want en", lang)
+	}
+	if err := runMessage(api, testMessage(TEST_USER_ID, TEST_USER_ID, "/help")); err != nil {
+		t.Fatal(err)
+	}
+	help, _ := renderTemplate(TEMPLATE_HELP, "en", nil)
+	if msg := api.lastSent(t).(*tgbotapi.MessageConfig); msg.Text != help {
+		t.Errorf("help is not in english: %q", msg.Text)
+	}
+}
+
+func TestRunFindCard(t *testing.T) {
+	store := useMemoryStore(t, testCards()...)
+	store.AddOwnedCards(TEST_USER_ID, []string{"1"})
+	api := &fakeSender{}
+	if err := runMessage(api, testMessage(TEST_GROUP_ID, TEST_USER_ID, "/find dragon")); err != nil {
+		t.Fatal(err)
+	}
+	msg := api.lastSent(t).(*tgbotapi.MessageConfig)
+	if !strings.Contains(msg.Text, "Fire Dragon") {
+		t.Errorf("the rarest card is not shown first: %q", msg.Text)
+	}
+	buttonData(t, msg.ReplyMarkup, "✅ Water Dragon")
+	if _, found, _ := store.LoadState(CALLBACK_STATE_FIND, TEST_GROUP_ID, api.lastId); !found {
+		t.Error("the state of the buttons is not saved")
+	}
+}
+
+func TestRunFindCardLongId(t *testing.T) {
+	cards := append(testCards(), &Card{Card_id: strings.Repeat("9", CALLBACK_MAX_LENGTH), Name: "Air Dragon", Rarity: 1})
+	useMemoryStore(t, cards...)
+	api := &fakeSender{}
+	if err := runMessage(api, testMessage(TEST_GROUP_ID, TEST_USER_ID, "/find dragon")); err == nil {
+		t.Error("a button with too long callback data is created")
+	}
+	if len(api.sent) != 0 {
+		t.Errorf("sent %v messages with a broken button, want none", len(api.sent))
+	}
+}
+
+func TestRunOwnAndBox(t *testing.T) {
+	var cards []*Card
+	for i := 1; i <= 200; i++ {
+		cards = append(cards, &Card{Card_id: strconv.Itoa(i), Name: strings.Repeat("Long name ", 5), Attribute: "Water", Rarity: 5})
+	}
+	useMemoryStore(t, cards...)
+	api := &fakeSender{}
+	ids := make([]string, len(cards))
+	for i, card := range cards {
+		ids[i] = card.Card_id
+	}
+	if err := runMessage(api, testMessage(TEST_USER_ID, TEST_USER_ID, "/own add 9999 "+strings.Join(ids, " "))); err != nil {
+		t.Fatal(err)
+	}
+	msg := api.lastSent(t).(*tgbotapi.MessageConfig)
+	if !strings.HasPrefix(msg.Text, tr(DEFAULT_LANGUAGE, "own_added", len(cards))) || !strings.Contains(msg.Text, "9999") {
+		t.Errorf("answer to /own add = %q", msg.Text)
+	}
+	if err := runMessage(api, testMessage(TEST_USER_ID, TEST_USER_ID, "/own remove 1 2 9999")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := api.lastSent(t).(*tgbotapi.MessageConfig); msg.Text != tr(DEFAULT_LANGUAGE, "own_removed", 2) {
+		t.Errorf("answer to /own remove = %q", msg.Text)
+	}
+
+	if err := runMessage(api, testMessage(TEST_USER_ID, TEST_USER_ID, "/box")); err != nil {
+		t.Fatal(err)
+	}
+	msg = api.lastSent(t).(*tgbotapi.MessageConfig)
+	if len(msg.Text) > TELEGRAM_MESSAGE_LIMIT {
+		t.Errorf("the box is %v bytes long", len(msg.Text))
+	}
+	if !strings.Contains(msg.Text, "[id:3]") || strings.Contains(msg.Text, "[id:1]") {
+		t.Errorf("the box doesn't start with the first owned card: %q", msg.Text[:100])
+	}
+	if !strings.Contains(msg.Text, strings.TrimSuffix(tr(DEFAULT_LANGUAGE, "box_more", 0), "0")) {
+		t.Error("the cut box doesn't tell about the rest")
+	}
+}
+
+func TestApplyCallbackQueryFind(t *testing.T) {
+	store := useMemoryStore(t, testCards()...)
+	api := &fakeSender{}
+	if err := runMessage(api, testMessage(TEST_GROUP_ID, TEST_USER_ID, "/find dragon")); err != nil {
+		t.Fatal(err)
+	}
+	messageId := api.lastId
+	data := buttonData(t, api.lastSent(t).(*tgbotapi.MessageConfig).ReplyMarkup, "Water Dragon")
+
+	if err := runCallback(api, TEST_GROUP_ID, messageId, TEST_OTHER_USER_ID, data); err != nil {
+		t.Fatal(err)
+	}
+	if text := api.lastAnswer(t); text != tr(DEFAULT_LANGUAGE, "no_permission_action") {
+		t.Errorf("answer to another user = %q", text)
+	}
+
+	if err := runCallback(api, TEST_GROUP_ID, messageId, TEST_USER_ID, data); err != nil {
+		t.Fatal(err)
+	}
+	edit, ok := api.lastSent(t).(*tgbotapi.EditMessageTextConfig)
+	if !ok || !strings.Contains(edit.Text, "Water Dragon") || edit.MessageID != messageId {
+		t.Fatalf("the message is not switched to the chosen card: %#v", api.lastSent(t))
+	}
+	buttonData(t, edit.ReplyMarkup, "Fire Dragon")
+
+	store.states = make(map[string]memoryState)
+	if err := runCallback(api, TEST_GROUP_ID, messageId, TEST_USER_ID, data); err != nil {
+		t.Fatal(err)
+	}
+	if text := api.lastAnswer(t); text != tr(DEFAULT_LANGUAGE, "callback_expired") {
+		t.Errorf("answer to an expired button = %q", text)
+	}
+}
+
+func TestApplyCallbackQueryForged(t *testing.T) {
+	useMemoryStore(t, testCards()...)
+	api := &fakeSender{}
+	data, _ := encodeCallback("find", "1")
+	forged := strings.Replace(data, "|1|", "|2|", 1)
+	if err := runCallback(api, TEST_GROUP_ID, 1, TEST_USER_ID, forged); err == nil {
+		t.Error("forged callback data is accepted")
+	}
+	if text := api.lastAnswer(t); text != tr(DEFAULT_LANGUAGE, "callback_invalid") {
+		t.Errorf("answer to forged data = %q", text)
+	}
+	if len(api.sent) != 0 {
+		t.Errorf("sent %v messages for forged data, want none", len(api.sent))
+	}
+}
+
+func TestPollFlow(t *testing.T) {
+	store := useMemoryStore(t)
+	api := &fakeSender{}
+
+	// the question and the options are asked, only replies to the questions are answers
+	if err := runMessage(api, testMessage(TEST_GROUP_ID, TEST_USER_ID, "/poll public")); err != nil {
+		t.Fatal(err)
+	}
+	answer := testMessage(TEST_GROUP_ID, TEST_USER_ID, "Best <attribute>?")
+	if err := runMessage(api, answer); err == nil {
+		t.Fatal("a message which is not a reply is taken as the answer")
+	}
+	answer.ReplyToMessage = &tgbotapi.Message{MessageID: api.lastId}
+	if err := runMessage(api, answer); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.LoadState(CALLBACK_STATE_CONVERSATION, TEST_GROUP_ID, TEST_USER_ID); !found {
+		t.Error("the conversation is not saved")
+	}
+	options := testMessage(TEST_GROUP_ID, TEST_USER_ID, "Water, Fire")
+	options.ReplyToMessage = &tgbotapi.Message{MessageID: api.lastId}
+	if err := runMessage(api, options); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.LoadState(CALLBACK_STATE_CONVERSATION, TEST_GROUP_ID, TEST_USER_ID); found {
+		t.Error("the finished conversation is kept")
+	}
+
+	msg := api.lastSent(t).(*tgbotapi.MessageConfig)
+	if !strings.HasPrefix(msg.Text, "<b>Best &lt;attribute&gt;?</b>") {
+		t.Errorf("the poll doesn't start with the escaped question: %q", msg.Text)
+	}
+	pollMessageId := api.lastId
+	poll, err := store.PollByMessage(TEST_GROUP_ID, pollMessageId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	water := buttonData(t, msg.ReplyMarkup, "Water (0)")
+	fire := buttonData(t, msg.ReplyMarkup, "Fire (0)")
+	closeData := buttonData(t, msg.ReplyMarkup, tr(DEFAULT_LANGUAGE, "poll_button_close"))
+
+	if err := runCallback(api, TEST_GROUP_ID, pollMessageId, TEST_USER_ID, water); err != nil {
+		t.Fatal(err)
+	}
+	if text := api.lastAnswer(t); text != tr(DEFAULT_LANGUAGE, "poll_vote_accepted") {
+		t.Errorf("answer to a vote = %q", text)
+	}
+	if err := runCallback(api, TEST_GROUP_ID, pollMessageId, TEST_USER_ID, fire); err != nil {
+		t.Fatal(err)
+	}
+	if text := api.lastAnswer(t); text != tr(DEFAULT_LANGUAGE, "poll_already_voted") {
+		t.Errorf("answer to a second vote = %q", text)
+	}
+	if err := runCallback(api, TEST_GROUP_ID, pollMessageId, TEST_OTHER_USER_ID, water); err != nil {
+		t.Fatal(err)
+	}
+	votes, _ := store.PollVotes(poll.Id)
+	if votes[0].Count != 2 || votes[1].Count != 0 {
+		t.Errorf("counts = %v and %v, want 2 and 0", votes[0].Count, votes[1].Count)
+	}
+
+	if err := runCallback(api, TEST_GROUP_ID, pollMessageId, TEST_OTHER_USER_ID, closeData); err != nil {
+		t.Fatal(err)
+	}
+	if text := api.lastAnswer(t); text != tr(DEFAULT_LANGUAGE, "poll_close_forbidden") {
+		t.Errorf("answer to closing by another user = %q", text)
+	}
+	sent := len(api.sent)
+	if err := runCallback(api, TEST_GROUP_ID, pollMessageId, TEST_USER_ID, closeData); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.sent) != sent+1 {
+		t.Fatalf("sent %v messages on close, want the edit of the poll", len(api.sent)-sent)
+	}
+	edit := api.lastSent(t).(tgbotapi.EditMessageTextConfig)
+	if !strings.HasPrefix(edit.Text, "<b>Best &lt;attribute&gt;?</b>") || !strings.Contains(edit.Text, "User I") {
+		t.Errorf("results lack the question or the voters: %q", edit.Text)
+	}
+	if closed, _ := store.PollById(poll.Id); !closed.Closed {
+		t.Error("the poll is not closed")
+	}
+
+	if err := runCallback(api, TEST_GROUP_ID, pollMessageId, TEST_OTHER_USER_ID, fire); err != nil {
+		t.Fatal(err)
+	}
+	if text := api.lastAnswer(t); text != tr(DEFAULT_LANGUAGE, "poll_already_closed") {
+		t.Errorf("answer to a vote in a closed poll = %q", text)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const TEMPLATE_CARD = "message_template"
+const TEMPLATE_CARD_MIN = "message_template_min"
+const TEMPLATE_HELP = "help_template"
+const TEMPLATE_COMPARE = "compare_template"
+const TEMPLATE_TEAM = "team_template"
+const TEMPLATE_DAMAGE = "dmg_template"
+const TEMPLATE_STAGE = "stage_template"
+const TEMPLATE_COUNTER = "counter_template"
+
+// how often template files are checked for changes
+const TEMPLATE_RELOAD_INTERVAL = 5 * time.Second
+
+var templateNames = []string{TEMPLATE_CARD, TEMPLATE_CARD_MIN, TEMPLATE_HELP, TEMPLATE_COMPARE, TEMPLATE_TEAM, TEMPLATE_DAMAGE, TEMPLATE_STAGE, TEMPLATE_COUNTER}
+
+// templateSamples are rendered once after loading, so a broken template
+// is reported at startup or reload instead of on the first user request.
+// Cards are checked with and without skills.
+var templateSamples = map[string][]interface{}{
+	TEMPLATE_CARD:     {&Card{ActiveSkill: &Skill{}, LeaderSkill: &Skill{}}, &Card{}},
+	TEMPLATE_CARD_MIN: {&Card{}},
+	TEMPLATE_HELP:     {nil},
+	TEMPLATE_COMPARE:  {newComparison([]*Card{{ActiveSkill: &Skill{}, LeaderSkill: &Skill{}}, {}})},
+	TEMPLATE_TEAM:     teamSamples,
+	TEMPLATE_DAMAGE:   teamSamples,
+	TEMPLATE_STAGE:    {newStageView(&Stage{}, []StageEnemy{{Floor: 1, Attribute: "Fire", Abilities: "sample"}, {Floor: 2}})},
+	TEMPLATE_COUNTER: {
+		&CounterView{Stage: &Stage{}},
+		&CounterView{Stage: &Stage{}, Owned: true, Counters: []AttributeCounter{
+			{Attribute: "Water", Against: []string{"Fire"}, Cards: []*Card{{}}, Leaders: []CounterLeader{{&Card{}, 2}}},
+		}},
+	},
+}
+
+var teamSamples = []interface{}{
+	newTeamView("", []*Card{{LeaderSkill: &Skill{Effect: "Water Attack x 2. When HP is above 80%, Attack x 1.5"}}, {}, {}, {}, {}, {LeaderSkill: &Skill{}}}),
+	newTeamView("sample", []*Card{{}, {}, {}, {}, {}, {}}),
+}
+
+type TemplateSet struct {
+	mx       sync.RWMutex
+	value    map[string]map[string]*template.Template
+	modified time.Time
+}
+
+var templates = TemplateSet{value: make(map[string]map[string]*template.Template)}
+
+func templatePath(name string, lang string) string {
+	return fmt.Sprintf("%v.%v.html", name, lang)
+}
+
+// templatesModified returns the newest modification time of the template files
+func templatesModified() time.Time {
+	var modified time.Time
+	for _, name := range templateNames {
+		for _, lang := range supportedLanguages {
+			info, err := os.Stat(templatePath(name, lang))
+			if err == nil && info.ModTime().After(modified) {
+				modified = info.ModTime()
+			}
+		}
+	}
+	return modified
+}
+
+// loadTemplates parses <name>.<lang>.html for every template and language.
+// The default language is required, translations are optional.
+// Templates are replaced only if all of them are valid.
+func loadTemplates() error {
+	modified := templatesModified()
+	loaded := make(map[string]map[string]*template.Template)
+	for _, name := range templateNames {
+		loaded[name] = make(map[string]*template.Template)
+		for _, lang := range supportedLanguages {
+			path := templatePath(name, lang)
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				if lang == DEFAULT_LANGUAGE {
+					return err
+				}
+				continue
+			}
+			tmpl, perr := template.New(path).Parse(string(content))
+			if perr != nil {
+				return perr
+			}
+			for _, sample := range templateSamples[name] {
+				eerr := tmpl.Execute(ioutil.Discard, sample)
+				if eerr != nil {
+					return eerr
+				}
+			}
+			loaded[name][lang] = tmpl
+		}
+	}
+	templates.mx.Lock()
+	templates.value = loaded
+	templates.modified = modified
+	templates.mx.Unlock()
+	return nil
+}
+
+// watchTemplates reloads templates when their files change on disk
+func watchTemplates() {
+	for range time.Tick(TEMPLATE_RELOAD_INTERVAL) {
+		templates.mx.RLock()
+		modified := templates.modified
+		templates.mx.RUnlock()
+		if !templatesModified().After(modified) {
+			continue
+		}
+		err := loadTemplates()
+		if err != nil {
+			log.Printf("[Error] Templates are not reloaded: %v", err)
+			// don't retry until the files change again
+			templates.mx.Lock()
+			templates.modified = templatesModified()
+			templates.mx.Unlock()
+			continue
+		}
+		log.Printf("Templates reloaded")
+	}
+}
+
+// renderTemplate executes the template in the given language, falling back to the default one
+func renderTemplate(name string, lang string, data interface{}) (string, error) {
+	var b bytes.Buffer
+	templates.mx.RLock()
+	tmpl, ok := templates.value[name][lang]
+	if !ok {
+		tmpl, ok = templates.value[name][DEFAULT_LANGUAGE]
+	}
+	templates.mx.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("Template %v is not loaded", name)
+	}
+	err := tmpl.Execute(&b, data)
+	return b.String(), err
+}
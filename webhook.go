@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// telegram sends the secret token of setWebhook in this header with every update
+const WEBHOOK_SECRET_HEADER = "X-Telegram-Bot-Api-Secret-Token"
+
+// updates are small, anything bigger is not from telegram
+const WEBHOOK_MAX_BODY = 1 << 20
+
+// webhookEnabled reports whether [webhook] url is set, otherwise the bot uses long polling
+func webhookEnabled() bool {
+	return config.Section("webhook").Key("url").Value() != ""
+}
+
+// setWebhook registers the webhook with the secret token. WebhookConfig of the
+// library has no secret token, so the request is made directly.
+func setWebhook(bot *tgbotapi.BotAPI, link string, secret string, cert string) error {
+	var resp tgbotapi.APIResponse
+	var err error
+	if cert != "" && config.Section("webhook").Key("upload_cert").MustBool(false) {
+		// a self-signed certificate has to be sent to telegram
+		resp, err = bot.UploadFile("setWebhook", map[string]string{"url": link, "secret_token": secret}, "certificate", cert)
+	} else {
+		resp, err = bot.MakeRequest("setWebhook", url.Values{"url": {link}, "secret_token": {secret}})
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("Can`t set webhook: %v", resp.Description)
+	}
+	return nil
+}
+
+// webhookHandler accepts updates carrying the secret token and passes them to the channel
+func webhookHandler(secret string, updates chan tgbotapi.Update) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.Header.Get(WEBHOOK_SECRET_HEADER)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			log.Printf("[Error] Webhook request from %v with a wrong secret token", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		var update tgbotapi.Update
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, WEBHOOK_MAX_BODY)).Decode(&update)
+		if err != nil {
+			log.Printf("[Error] Can`t decode webhook update: %v", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		updates <- update
+	}
+}
+
+// listenWebhook sets the webhook and serves it on [webhook] listen. TLS is used
+// when [webhook] cert and key are set, behind a reverse proxy plain http is enough.
+// Updates come to the returned channel like from long polling.
+func listenWebhook(bot *tgbotapi.BotAPI) (tgbotapi.UpdatesChannel, *http.Server, error) {
+	section := config.Section("webhook")
+	link := section.Key("url").Value()
+	secret := section.Key("secret").Value()
+	cert := section.Key("cert").Value()
+	key := section.Key("key").Value()
+	if secret == "" {
+		return nil, nil, errors.New("[webhook] secret is required in the webhook mode")
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return nil, nil, err
+	}
+	path := section.Key("path").MustString(parsed.Path)
+	if path == "" {
+		path = "/"
+	}
+
+	updates := make(chan tgbotapi.Update, bot.Buffer)
+	mux := http.NewServeMux()
+	mux.Handle(path, webhookHandler(secret, updates))
+	server := &http.Server{Addr: section.Key("listen").MustString(":8443"), Handler: mux}
+	go func() {
+		var serr error
+		if cert != "" && key != "" {
+			serr = server.ListenAndServeTLS(cert, key)
+		} else {
+			serr = server.ListenAndServe()
+		}
+		if serr != http.ErrServerClosed {
+			log.Panic(serr)
+		}
+	}()
+
+	err = setWebhook(bot, link, secret, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Listening for webhook updates on %v%v", server.Addr, path)
+	return updates, server, nil
+}